@@ -0,0 +1,487 @@
+// Package config collects the server settings. Every setting can be given as
+// a command-line flag or an environment variable; flags win over the
+// environment, and the environment wins over the built-in defaults.
+package config
+
+import (
+	"flag"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Config struct {
+	Addr            string        // listen address, e.g. ":8080"
+	DatabaseDSN     string        // SQLite data source name
+	TemplateDir     string        // directory holding the *.html templates
+	StaticDir       string        // directory served under /static/
+	SessionLifetime time.Duration // how long a login stays valid
+	BcryptCost      int           // cost used when hashing passwords
+
+	ReadTimeout     time.Duration // maximum time to read a whole request
+	WriteTimeout    time.Duration // maximum time to write a response
+	IdleTimeout     time.Duration // how long keep-alive connections may sit idle
+	MaxHeaderBytes  int           // largest request header accepted
+	ShutdownTimeout time.Duration // how long to wait for in-flight requests on shutdown
+
+	TLSCertFile string // serve HTTPS when both TLSCertFile and TLSKeyFile are set
+	TLSKeyFile  string
+
+	// Reverse proxies whose X-Forwarded-For header is believed. Without
+	// any, the client address is that of the connection.
+	TrustedProxies []netip.Prefix
+
+	CSRFKey string // secret for CSRF tokens; random per process when empty
+	LinkKey string // secret for emailed links; random per process when empty, required with SMTPAddr
+
+	MaxCommentDepth int // deepest reply level shown nested; deeper replies are shown at this level
+
+	Reactions []Reaction // the reactions offered on posts and comments, in button order
+
+	ReportThreshold int // distinct reporters that hide a post or comment until a moderator looks; 0 never hides
+
+	// Anti-flood budgets, per user and per IP address
+	RateLogin    RateLimit // login and registration attempts
+	RatePost     RateLimit // new posts
+	RateComment  RateLimit // new comments
+	RateReaction RateLimit // reactions to posts and comments
+	RateReport   RateLimit // reports of posts and comments
+
+	// Brute-force protection for logins
+	LoginMaxFailures   int           // failed logins in a row that lock an account; 0 turns account lockout off
+	LoginIPMaxFailures int           // failed logins from one IP address that block it; 0 never blocks
+	LoginLockout       time.Duration // how long a lock or block lasts, and how long a failure counts
+
+	// Outgoing email. Without an SMTP server, emails are written to MailFile,
+	// or to the log when that is empty too.
+	SMTPAddr     string // host:port of the SMTP server
+	SMTPUsername string // SMTP login; no authentication when empty
+	SMTPPassword string
+	MailFrom     string // sender address of the forum's emails
+	MailFile     string
+	BaseURL      string // address users reach the forum at, for links in emails
+
+	RequireVerifiedEmail bool // users can't post or comment before verifying their email
+
+	Migrate bool   // apply pending migrations and exit instead of serving
+	SetRole string // "username=role": give a user a role and exit instead of serving
+}
+
+// Reaction is one of the reactions users can give posts and comments.
+type Reaction struct {
+	Name  string // identifier used in forms, the API and the database
+	Emoji string // what the button shows
+}
+
+// RateLimit allows Count actions per Per: up to Count at once, then one more
+// every Per/Count. A zero Count means no limit.
+type RateLimit struct {
+	Count int
+	Per   time.Duration
+}
+
+// DefaultReactions is the reaction set unless -reactions says otherwise.
+const DefaultReactions = "like=👍,dislike=👎,love=❤️,laugh=😂,celebrate=🎉,wow=😮"
+
+// Default returns the settings used when nothing else is configured.
+func Default() *Config {
+	return &Config{
+		Addr:               ":8080",
+		DatabaseDSN:        "./forum.db",
+		TemplateDir:        "templates",
+		StaticDir:          "static",
+		SessionLifetime:    24 * time.Hour,
+		BcryptCost:         bcrypt.DefaultCost,
+		ReadTimeout:        10 * time.Second,
+		WriteTimeout:       30 * time.Second,
+		IdleTimeout:        2 * time.Minute,
+		MaxHeaderBytes:     64 << 10,
+		ShutdownTimeout:    15 * time.Second,
+		MaxCommentDepth:    5,
+		ReportThreshold:    3,
+		RateLogin:          RateLimit{Count: 10, Per: 5 * time.Minute},
+		RatePost:           RateLimit{Count: 5, Per: 10 * time.Minute},
+		RateComment:        RateLimit{Count: 20, Per: 10 * time.Minute},
+		RateReaction:       RateLimit{Count: 60, Per: time.Minute},
+		RateReport:         RateLimit{Count: 10, Per: 10 * time.Minute},
+		LoginMaxFailures:   5,
+		LoginIPMaxFailures: 20,
+		LoginLockout:       15 * time.Minute,
+		MailFrom:           "forum@localhost",
+		BaseURL:            "http://localhost:8080",
+		Reactions:          mustParseReactions(DefaultReactions),
+	}
+}
+
+// Load builds the configuration from the environment and the command-line
+// arguments (without the program name).
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	fs := flag.NewFlagSet("forum", flag.ContinueOnError)
+	fs.StringVar(&cfg.Addr, "addr", cfg.Addr, "listen address (FORUM_ADDR)")
+	fs.StringVar(&cfg.DatabaseDSN, "db", cfg.DatabaseDSN, "SQLite database DSN (FORUM_DB)")
+	fs.StringVar(&cfg.TemplateDir, "templates", cfg.TemplateDir, "template directory (FORUM_TEMPLATES)")
+	fs.StringVar(&cfg.StaticDir, "static", cfg.StaticDir, "static files directory (FORUM_STATIC)")
+	fs.DurationVar(&cfg.SessionLifetime, "session-lifetime", cfg.SessionLifetime, "how long a login stays valid (FORUM_SESSION_LIFETIME)")
+	fs.IntVar(&cfg.BcryptCost, "bcrypt-cost", cfg.BcryptCost, "bcrypt cost for password hashes (FORUM_BCRYPT_COST)")
+	fs.DurationVar(&cfg.ReadTimeout, "read-timeout", cfg.ReadTimeout, "maximum time to read a request (FORUM_READ_TIMEOUT)")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", cfg.WriteTimeout, "maximum time to write a response (FORUM_WRITE_TIMEOUT)")
+	fs.DurationVar(&cfg.IdleTimeout, "idle-timeout", cfg.IdleTimeout, "keep-alive idle timeout (FORUM_IDLE_TIMEOUT)")
+	fs.IntVar(&cfg.MaxHeaderBytes, "max-header-bytes", cfg.MaxHeaderBytes, "largest request header accepted (FORUM_MAX_HEADER_BYTES)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "time allowed for draining requests on shutdown (FORUM_SHUTDOWN_TIMEOUT)")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert", cfg.TLSCertFile, "TLS certificate file (FORUM_TLS_CERT)")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key", cfg.TLSKeyFile, "TLS private key file (FORUM_TLS_KEY)")
+	fs.Func("trusted-proxies", "comma separated addresses or CIDR ranges of reverse proxies whose X-Forwarded-For is believed (FORUM_TRUSTED_PROXIES)", func(v string) (err error) {
+		cfg.TrustedProxies, err = ParseTrustedProxies(v)
+		return err
+	})
+	fs.StringVar(&cfg.CSRFKey, "csrf-key", cfg.CSRFKey, "secret used to sign CSRF tokens (FORUM_CSRF_KEY)")
+	fs.StringVar(&cfg.LinkKey, "link-key", cfg.LinkKey, "secret used to sign password reset and verification links; required with -smtp-addr (FORUM_LINK_KEY)")
+	fs.IntVar(&cfg.MaxCommentDepth, "max-comment-depth", cfg.MaxCommentDepth, "deepest nesting level of comment replies (FORUM_MAX_COMMENT_DEPTH)")
+	fs.Func("reactions", "reaction set as name=emoji pairs, must include like and dislike (FORUM_REACTIONS; default "+DefaultReactions+")", func(v string) (err error) {
+		cfg.Reactions, err = ParseReactions(v)
+		return err
+	})
+	fs.IntVar(&cfg.ReportThreshold, "report-threshold", cfg.ReportThreshold, "reports from distinct users that hide a post or comment, 0 to never hide (FORUM_REPORT_THRESHOLD)")
+	for _, rate := range cfg.rateLimits() {
+		dst := rate.dst
+		fs.Func(rate.flag, rate.usage+" as count/duration, or off ("+rate.env+"; default "+dst.String()+")", func(v string) (err error) {
+			*dst, err = ParseRateLimit(v)
+			return err
+		})
+	}
+	fs.IntVar(&cfg.LoginMaxFailures, "login-max-failures", cfg.LoginMaxFailures, "failed logins in a row that lock an account, 0 to never lock (FORUM_LOGIN_MAX_FAILURES)")
+	fs.IntVar(&cfg.LoginIPMaxFailures, "login-ip-max-failures", cfg.LoginIPMaxFailures, "failed logins from one IP address that block it, 0 to never block (FORUM_LOGIN_IP_MAX_FAILURES)")
+	fs.DurationVar(&cfg.LoginLockout, "login-lockout", cfg.LoginLockout, "how long a locked account or blocked IP address waits (FORUM_LOGIN_LOCKOUT)")
+	fs.StringVar(&cfg.SMTPAddr, "smtp-addr", cfg.SMTPAddr, "SMTP server as host:port; without it emails go to -mail-file or the log (FORUM_SMTP_ADDR)")
+	fs.StringVar(&cfg.SMTPUsername, "smtp-username", cfg.SMTPUsername, "SMTP login (FORUM_SMTP_USERNAME)")
+	fs.StringVar(&cfg.SMTPPassword, "smtp-password", cfg.SMTPPassword, "SMTP password; prefer the environment variable (FORUM_SMTP_PASSWORD)")
+	fs.StringVar(&cfg.MailFrom, "mail-from", cfg.MailFrom, "sender address of the forum's emails (FORUM_MAIL_FROM)")
+	fs.StringVar(&cfg.MailFile, "mail-file", cfg.MailFile, "file to append emails to when there is no SMTP server (FORUM_MAIL_FILE)")
+	fs.StringVar(&cfg.BaseURL, "base-url", cfg.BaseURL, "address users reach the forum at, for links in emails (FORUM_BASE_URL)")
+	fs.BoolVar(&cfg.RequireVerifiedEmail, "require-verified-email", cfg.RequireVerifiedEmail, "only let users with a verified email post and comment (FORUM_REQUIRE_VERIFIED_EMAIL)")
+	fs.BoolVar(&cfg.Migrate, "migrate", false, "apply pending database migrations and exit")
+	fs.StringVar(&cfg.SetRole, "set-role", "", "give a user a role (member, moderator or admin) and exit, as username=role")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) loadEnv() error {
+	if v := os.Getenv("FORUM_ADDR"); v != "" {
+		cfg.Addr = v
+	}
+	if v := os.Getenv("FORUM_DB"); v != "" {
+		cfg.DatabaseDSN = v
+	}
+	if v := os.Getenv("FORUM_TEMPLATES"); v != "" {
+		cfg.TemplateDir = v
+	}
+	if v := os.Getenv("FORUM_STATIC"); v != "" {
+		cfg.StaticDir = v
+	}
+	if v := os.Getenv("FORUM_TLS_CERT"); v != "" {
+		cfg.TLSCertFile = v
+	}
+	if v := os.Getenv("FORUM_TLS_KEY"); v != "" {
+		cfg.TLSKeyFile = v
+	}
+	if v := os.Getenv("FORUM_TRUSTED_PROXIES"); v != "" {
+		proxies, err := ParseTrustedProxies(v)
+		if err != nil {
+			return fmt.Errorf("FORUM_TRUSTED_PROXIES: %w", err)
+		}
+		cfg.TrustedProxies = proxies
+	}
+	if v := os.Getenv("FORUM_CSRF_KEY"); v != "" {
+		cfg.CSRFKey = v
+	}
+	if v := os.Getenv("FORUM_LINK_KEY"); v != "" {
+		cfg.LinkKey = v
+	}
+	if v := os.Getenv("FORUM_SMTP_ADDR"); v != "" {
+		cfg.SMTPAddr = v
+	}
+	if v := os.Getenv("FORUM_SMTP_USERNAME"); v != "" {
+		cfg.SMTPUsername = v
+	}
+	if v := os.Getenv("FORUM_SMTP_PASSWORD"); v != "" {
+		cfg.SMTPPassword = v
+	}
+	if v := os.Getenv("FORUM_MAIL_FROM"); v != "" {
+		cfg.MailFrom = v
+	}
+	if v := os.Getenv("FORUM_MAIL_FILE"); v != "" {
+		cfg.MailFile = v
+	}
+	if v := os.Getenv("FORUM_BASE_URL"); v != "" {
+		cfg.BaseURL = v
+	}
+	if v := os.Getenv("FORUM_REQUIRE_VERIFIED_EMAIL"); v != "" {
+		require, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("FORUM_REQUIRE_VERIFIED_EMAIL: %w", err)
+		}
+		cfg.RequireVerifiedEmail = require
+	}
+	if v := os.Getenv("FORUM_REACTIONS"); v != "" {
+		reactions, err := ParseReactions(v)
+		if err != nil {
+			return fmt.Errorf("FORUM_REACTIONS: %w", err)
+		}
+		cfg.Reactions = reactions
+	}
+
+	for _, rate := range cfg.rateLimits() {
+		if v := os.Getenv(rate.env); v != "" {
+			limit, err := ParseRateLimit(v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", rate.env, err)
+			}
+			*rate.dst = limit
+		}
+	}
+
+	durations := []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"FORUM_SESSION_LIFETIME", &cfg.SessionLifetime},
+		{"FORUM_READ_TIMEOUT", &cfg.ReadTimeout},
+		{"FORUM_WRITE_TIMEOUT", &cfg.WriteTimeout},
+		{"FORUM_IDLE_TIMEOUT", &cfg.IdleTimeout},
+		{"FORUM_SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout},
+		{"FORUM_LOGIN_LOCKOUT", &cfg.LoginLockout},
+	}
+	for _, d := range durations {
+		if err := envDuration(d.env, d.dst); err != nil {
+			return err
+		}
+	}
+
+	ints := []struct {
+		env string
+		dst *int
+	}{
+		{"FORUM_BCRYPT_COST", &cfg.BcryptCost},
+		{"FORUM_MAX_HEADER_BYTES", &cfg.MaxHeaderBytes},
+		{"FORUM_MAX_COMMENT_DEPTH", &cfg.MaxCommentDepth},
+		{"FORUM_REPORT_THRESHOLD", &cfg.ReportThreshold},
+		{"FORUM_LOGIN_MAX_FAILURES", &cfg.LoginMaxFailures},
+		{"FORUM_LOGIN_IP_MAX_FAILURES", &cfg.LoginIPMaxFailures},
+	}
+	for _, i := range ints {
+		if err := envInt(i.env, i.dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func envDuration(name string, dst *time.Duration) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = d
+	return nil
+}
+
+func envInt(name string, dst *int) error {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	*dst = n
+	return nil
+}
+
+// ParseTrustedProxies reads a comma separated list of IP addresses and CIDR
+// ranges such as "10.0.0.0/8,192.0.2.7".
+func ParseTrustedProxies(v string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(item); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, want an IP address or CIDR range", item)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+	return proxies, nil
+}
+
+// ParseReactions reads a reaction set written as comma separated name=emoji
+// pairs. Names are lower case letters, digits and underscores. The set must
+// include "like" and "dislike", which make up the score of posts and
+// comments.
+func ParseReactions(v string) ([]Reaction, error) {
+	var reactions []Reaction
+	seen := make(map[string]bool)
+	for _, pair := range strings.Split(v, ",") {
+		name, emoji, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		name, emoji = strings.TrimSpace(name), strings.TrimSpace(emoji)
+		if !ok || emoji == "" || !validReactionName(name) {
+			return nil, fmt.Errorf("invalid reaction %q, want name=emoji", pair)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("reaction %q listed twice", name)
+		}
+		seen[name] = true
+		reactions = append(reactions, Reaction{Name: name, Emoji: emoji})
+	}
+	if !seen["like"] || !seen["dislike"] {
+		return nil, fmt.Errorf("the reaction set must include like and dislike")
+	}
+	return reactions, nil
+}
+
+func mustParseReactions(v string) []Reaction {
+	reactions, err := ParseReactions(v)
+	if err != nil {
+		panic(err)
+	}
+	return reactions
+}
+
+func validReactionName(name string) bool {
+	if name == "" || len(name) > 32 {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// HasReaction reports whether name is in the reaction set.
+func (cfg *Config) HasReaction(name string) bool {
+	for _, reaction := range cfg.Reactions {
+		if reaction.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// rateSetting ties a rate limit to its flag and environment variable.
+type rateSetting struct {
+	flag, env, usage string
+	dst              *RateLimit
+}
+
+func (cfg *Config) rateLimits() []rateSetting {
+	return []rateSetting{
+		{"rate-login", "FORUM_RATE_LOGIN", "login and registration attempts", &cfg.RateLogin},
+		{"rate-post", "FORUM_RATE_POST", "new posts", &cfg.RatePost},
+		{"rate-comment", "FORUM_RATE_COMMENT", "new comments", &cfg.RateComment},
+		{"rate-reaction", "FORUM_RATE_REACTION", "reactions", &cfg.RateReaction},
+		{"rate-report", "FORUM_RATE_REPORT", "reports", &cfg.RateReport},
+	}
+}
+
+// ParseRateLimit reads a rate limit written as count/duration, e.g. "5/10m"
+// for five per ten minutes. "off" or "0" turns the limit off.
+func ParseRateLimit(v string) (RateLimit, error) {
+	v = strings.TrimSpace(v)
+	if v == "off" || v == "0" {
+		return RateLimit{}, nil
+	}
+	count, per, ok := strings.Cut(v, "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n < 1 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, want count/duration such as 5/10m", v)
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid rate limit %q, want count/duration such as 5/10m", v)
+	}
+	return RateLimit{Count: n, Per: d}, nil
+}
+
+// String formats the limit the way ParseRateLimit reads it.
+func (l RateLimit) String() string {
+	if l.Count == 0 {
+		return "off"
+	}
+	return strconv.Itoa(l.Count) + "/" + l.Per.String()
+}
+
+// TLS reports whether the server should serve HTTPS.
+func (cfg *Config) TLS() bool {
+	return cfg.TLSCertFile != "" && cfg.TLSKeyFile != ""
+}
+
+func (cfg *Config) validate() error {
+	if cfg.SessionLifetime <= 0 {
+		return fmt.Errorf("session lifetime must be positive, got %s", cfg.SessionLifetime)
+	}
+	if cfg.MaxHeaderBytes <= 0 {
+		return fmt.Errorf("max header bytes must be positive, got %d", cfg.MaxHeaderBytes)
+	}
+	if cfg.MaxCommentDepth < 1 {
+		return fmt.Errorf("max comment depth must be at least 1, got %d", cfg.MaxCommentDepth)
+	}
+	if cfg.ReportThreshold < 0 {
+		return fmt.Errorf("report threshold can't be negative, got %d", cfg.ReportThreshold)
+	}
+	if cfg.LoginMaxFailures < 0 || cfg.LoginIPMaxFailures < 0 {
+		return fmt.Errorf("login failure limits can't be negative")
+	}
+	if cfg.LoginLockout <= 0 {
+		return fmt.Errorf("login lockout must be positive, got %s", cfg.LoginLockout)
+	}
+	if u, err := url.Parse(cfg.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("base URL must be an absolute http or https URL, got %q", cfg.BaseURL)
+	}
+	if !strings.Contains(cfg.MailFrom, "@") {
+		return fmt.Errorf("mail sender must be an email address, got %q", cfg.MailFrom)
+	}
+	if cfg.SMTPAddr != "" && cfg.LinkKey == "" {
+		return fmt.Errorf("-smtp-addr needs -link-key (FORUM_LINK_KEY), or emailed links break on every restart and across instances")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return fmt.Errorf("TLS needs both a certificate and a key file")
+	}
+	if cfg.SetRole != "" {
+		if name, role, ok := strings.Cut(cfg.SetRole, "="); !ok || name == "" || role == "" {
+			return fmt.Errorf("set-role must look like username=role, got %q", cfg.SetRole)
+		}
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, cfg.BcryptCost)
+	}
+	return nil
+}
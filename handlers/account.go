@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AccountHandler lists the active sessions and API tokens of the logged in
+// user.
+func (app *App) AccountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	app.renderAccount(w, r, make(map[string]interface{}))
+}
+
+// renderAccount fills pageData with the user's sessions and tokens and
+// renders the account page.
+func (app *App) renderAccount(w http.ResponseWriter, r *http.Request, pageData map[string]interface{}) {
+	user := currentUser(r)
+	sessions, err := app.Sessions.List(user.ID)
+	if err != nil {
+		log.Println("Error listing sessions:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+
+	current := models.SessionKey(currentSessionID(r))
+	var sessionDetails []map[string]interface{}
+	for _, session := range sessions {
+		sessionDetail := map[string]interface{}{
+			"Key":       session.Key,
+			"UserAgent": session.UserAgent,
+			"IP":        session.IP,
+			"CreatedAt": session.CreatedAt.Format("2006-01-02 15:04:05"),
+			"LastSeen":  session.LastSeen.Format("2006-01-02 15:04:05"),
+			"Current":   session.Key == current,
+		}
+		sessionDetails = append(sessionDetails, sessionDetail)
+	}
+
+	tokens, err := models.GetUserAPITokens(user.ID)
+	if err != nil {
+		log.Println("Error listing API tokens:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	var tokenDetails []map[string]interface{}
+	for _, token := range tokens {
+		tokenDetail := map[string]interface{}{
+			"ID":        token.ID,
+			"Name":      token.Name,
+			"Scope":     token.Scope,
+			"CreatedAt": token.CreatedAt.Format("2006-01-02 15:04:05"),
+			"LastUsed":  "never",
+		}
+		if !token.LastUsedAt.IsZero() {
+			tokenDetail["LastUsed"] = token.LastUsedAt.Format("2006-01-02 15:04:05")
+		}
+		tokenDetails = append(tokenDetails, tokenDetail)
+	}
+
+	pageData["IsLoggedIn"] = true
+	pageData["UserID"] = user.Username
+	pageData["Email"] = user.Email
+	pageData["EmailVerified"] = user.EmailVerified
+	pageData["Sessions"] = sessionDetails
+	pageData["Tokens"] = tokenDetails
+	pageData["Scopes"] = models.TokenScopes
+	app.RenderTemplate(w, r, "account", pageData)
+}
+
+// RevokeSessionHandler ends one of the user's sessions, picked by its key.
+func (app *App) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := r.FormValue("session")
+	if key == "" {
+		http.Error(w, "Bad request: Missing session", http.StatusBadRequest) // 400
+		return
+	}
+
+	sessions, err := app.Sessions.List(user.ID)
+	if err != nil {
+		log.Println("Error listing sessions:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	for _, session := range sessions {
+		if session.Key != key {
+			continue
+		}
+		if err := app.Sessions.DeleteKey(user.ID, key); err != nil {
+			log.Println("Error deleting session:", err)
+			w.WriteHeader(http.StatusInternalServerError) // 500
+			app.RenderTemplate(w, r, "500", nil)
+			return
+		}
+		if key == models.SessionKey(currentSessionID(r)) {
+			expireSessionCookie(w)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		break
+	}
+
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
+
+// RevokeAllSessionsHandler logs the user out on every device, this one included.
+func (app *App) RevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := app.Sessions.DeleteAll(user.ID); err != nil {
+		log.Println("Error deleting sessions:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	expireSessionCookie(w)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// CreateTokenHandler issues a personal access token and shows it once.
+func (app *App) CreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	scope := r.FormValue("scope")
+	if name == "" {
+		http.Error(w, "Bad request: Missing token name", http.StatusBadRequest) // 400
+		return
+	}
+
+	_, token, err := models.CreateAPIToken(user.ID, name, scope)
+	if errors.Is(err, models.ErrInvalidScope) {
+		http.Error(w, "Bad request: Invalid scope", http.StatusBadRequest) // 400
+		return
+	}
+	if err != nil {
+		log.Println("Error creating API token:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+
+	// The token is only known until this page is rendered.
+	w.Header().Set("Cache-Control", "no-store")
+	app.renderAccount(w, r, map[string]interface{}{"NewToken": token, "NewTokenName": name})
+}
+
+// RevokeTokenHandler deletes one of the user's personal access tokens.
+func (app *App) RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tokenID, err := strconv.Atoi(r.FormValue("token_id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid token", http.StatusBadRequest) // 400
+		return
+	}
+	if err := models.DeleteAPIToken(tokenID, user.ID); err != nil && !errors.Is(err, models.ErrTokenNotFound) {
+		log.Println("Error deleting API token:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	http.Redirect(w, r, "/account", http.StatusSeeOther)
+}
@@ -0,0 +1,514 @@
+package handlers
+
+import (
+	"Forum/models"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAPIBody caps the size of JSON request bodies.
+const maxAPIBody = 1 << 20
+
+// --- Response types ---
+
+type apiError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"` // what is wrong with each request field, for invalid_input
+}
+
+// apiErrorResponse is the body of every API error.
+type apiErrorResponse struct {
+	Error apiError `json:"error"`
+}
+
+type apiUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"` // only shown to the user themselves
+	Role     string `json:"role,omitempty"`
+
+	EmailVerified *bool `json:"email_verified,omitempty"` // only shown to the user themselves
+}
+
+type apiCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type apiPost struct {
+	ID         int           `json:"id"`
+	Title      string        `json:"title"`
+	Content    string        `json:"content"`
+	Author     string        `json:"author"`
+	AuthorID   int           `json:"author_id"`
+	Categories []apiCategory `json:"categories"`
+	Score      int           `json:"score"`            // likes minus dislikes
+	Hidden     bool          `json:"hidden,omitempty"` // only moderators see hidden posts
+	Locked     bool          `json:"locked,omitempty"` // no new comments
+	CreatedAt  string        `json:"created_at"`
+	UpdatedAt  string        `json:"updated_at,omitempty"`
+}
+
+type apiPostDetail struct {
+	apiPost
+	Likes      int            `json:"likes"`
+	Dislikes   int            `json:"dislikes"`
+	Reactions  map[string]int `json:"reactions"`             // count of every reaction in the set
+	MyReaction string         `json:"my_reaction,omitempty"` // the caller's reaction
+}
+
+type apiReaction struct {
+	Name  string `json:"name"`
+	Emoji string `json:"emoji"`
+}
+
+type apiPostList struct {
+	Posts []apiPost `json:"posts"`
+	Next  string    `json:"next,omitempty"` // pass as ?before= for the next page
+	Prev  string    `json:"prev,omitempty"` // pass as ?after= for the previous page
+}
+
+type apiComment struct {
+	ID         int            `json:"id"`
+	PostID     int            `json:"post_id"`
+	ParentID   int            `json:"parent_id,omitempty"`
+	Author     string         `json:"author,omitempty"`
+	AuthorID   int            `json:"author_id,omitempty"`
+	Content    string         `json:"content"`
+	CreatedAt  string         `json:"created_at"`
+	UpdatedAt  string         `json:"updated_at,omitempty"`
+	Deleted    bool           `json:"deleted,omitempty"`
+	Hidden     bool           `json:"hidden,omitempty"` // content is only shown to moderators
+	Likes      int            `json:"likes"`
+	Dislikes   int            `json:"dislikes"`
+	Reactions  map[string]int `json:"reactions"`
+	MyReaction string         `json:"my_reaction,omitempty"`
+	Replies    []apiComment   `json:"replies,omitempty"`
+}
+
+type apiToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+	User      apiUser   `json:"user"`
+}
+
+// apiPersonalToken describes a personal access token. Token is only set in
+// the response that creates it.
+type apiPersonalToken struct {
+	ID         int        `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Token      string     `json:"token,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// apiModAction is an entry of the moderation audit log. ActorID is 0 for
+// actions that didn't come from a user.
+type apiModAction struct {
+	ID        int       `json:"id"`
+	ActorID   int       `json:"actor_id"`
+	Actor     string    `json:"actor,omitempty"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target"`
+	TargetID  int       `json:"target_id"`
+	Reason    string    `json:"reason"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type apiReport struct {
+	Reporter  string    `json:"reporter"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiReportedItem is a post or comment in the moderation queue.
+type apiReportedItem struct {
+	Target   string      `json:"target"`
+	TargetID int         `json:"target_id"`
+	PostID   int         `json:"post_id,omitempty"`
+	Title    string      `json:"title,omitempty"`
+	Content  string      `json:"content,omitempty"`
+	Author   string      `json:"author,omitempty"`
+	Hidden   bool        `json:"hidden,omitempty"`
+	Deleted  bool        `json:"deleted,omitempty"`
+	Reports  []apiReport `json:"reports"`
+}
+
+type apiNotification struct {
+	ID        int       `json:"id"`
+	Message   string    `json:"message"`
+	Link      string    `json:"link,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Read      bool      `json:"read"`
+}
+
+// --- Routing ---
+
+// apiRoutes serves the JSON API under /api/v1. It shares the models with the
+// HTML handlers; only the encoding differs.
+func (app *App) apiRoutes() http.Handler {
+	api := http.NewServeMux()
+	api.HandleFunc("POST /api/v1/auth/register", app.RateLimit("login", app.apiRegister))
+	api.HandleFunc("POST /api/v1/auth/login", app.RateLimit("login", app.apiLogin))
+	api.HandleFunc("POST /api/v1/auth/logout", app.RequireAuth(app.apiLogout))
+	api.HandleFunc("POST /api/v1/auth/forgot-password", app.RateLimit("login", app.apiForgotPassword))
+	api.HandleFunc("POST /api/v1/auth/reset-password", app.RateLimit("login", app.apiResetPassword))
+	api.HandleFunc("POST /api/v1/auth/verify-email", app.apiVerifyEmail)
+	api.HandleFunc("GET /api/v1/me", app.RequireAuth(app.apiMe))
+	api.HandleFunc("POST /api/v1/me/verify-email", app.RequireSession(app.RateLimit("login", app.apiResendVerification)))
+	api.HandleFunc("GET /api/v1/notifications", app.RequireAuth(app.apiListNotifications))
+	api.HandleFunc("POST /api/v1/notifications/read", app.RequireAuth(app.apiReadNotifications))
+	api.HandleFunc("GET /api/v1/tokens", app.RequireSession(app.apiListTokens))
+	api.HandleFunc("POST /api/v1/tokens", app.RequireSession(app.apiCreateToken))
+	api.HandleFunc("DELETE /api/v1/tokens/{id}", app.RequireSession(app.apiDeleteToken))
+
+	api.HandleFunc("GET /api/v1/categories", app.apiListCategories)
+	api.HandleFunc("GET /api/v1/reactions", app.apiListReactions)
+	api.HandleFunc("GET /api/v1/posts", app.apiListPosts)
+	api.HandleFunc("POST /api/v1/posts", app.RequireAuth(app.RequireVerified(app.RateLimit("post", app.apiCreatePost))))
+	api.HandleFunc("GET /api/v1/posts/{id}", app.apiGetPost)
+	api.HandleFunc("PUT /api/v1/posts/{id}", app.RequireAuth(app.apiUpdatePost))
+	api.HandleFunc("DELETE /api/v1/posts/{id}", app.RequireAuth(app.apiDeletePost))
+	api.HandleFunc("PUT /api/v1/posts/{id}/reaction", app.RequireAuth(app.RateLimit("reaction", app.apiReactToPost)))
+	api.HandleFunc("GET /api/v1/posts/{id}/comments", app.apiListComments)
+	api.HandleFunc("POST /api/v1/posts/{id}/comments", app.RequireAuth(app.RequireVerified(app.RateLimit("comment", app.apiCreateComment))))
+	api.HandleFunc("PUT /api/v1/comments/{id}", app.RequireAuth(app.apiUpdateComment))
+	api.HandleFunc("DELETE /api/v1/comments/{id}", app.RequireAuth(app.apiDeleteComment))
+	api.HandleFunc("PUT /api/v1/comments/{id}/reaction", app.RequireAuth(app.RateLimit("reaction", app.apiReactToComment)))
+	api.HandleFunc("POST /api/v1/posts/{id}/report", app.RequireAuth(app.RateLimit("report", app.apiReportPost)))
+	api.HandleFunc("POST /api/v1/comments/{id}/report", app.RequireAuth(app.RateLimit("report", app.apiReportComment)))
+
+	api.HandleFunc("GET /api/v1/mod/log", app.RequireModerator(app.apiModLog))
+	api.HandleFunc("POST /api/v1/mod/posts/{id}/{action}", app.RequireModerator(app.apiModeratePost))
+	api.HandleFunc("POST /api/v1/mod/comments/{id}/{action}", app.RequireModerator(app.apiModerateComment))
+	api.HandleFunc("PUT /api/v1/mod/users/{id}/role", app.RequireModerator(app.apiSetUserRole))
+	api.HandleFunc("POST /api/v1/mod/users/{id}/unlock", app.RequireModerator(app.apiUnlockUser))
+	api.HandleFunc("GET /api/v1/mod/reports", app.RequireModerator(app.apiReportQueue))
+	api.HandleFunc("POST /api/v1/mod/reports/{target}/{id}", app.RequireModerator(app.apiResolveReports))
+
+	api.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "No such endpoint: "+r.Method+" "+r.URL.Path) // 404
+	})
+	return api
+}
+
+// --- Helpers ---
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("Error writing JSON response:", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiErrorResponse{Error: apiError{Code: code, Message: message}})
+}
+
+// apiFieldNames renames the form fields of a models.ValidationError to the
+// request fields of the API where they differ.
+var apiFieldNames = map[string]string{
+	"categories": "category_ids",
+	"comment":    "content",
+}
+
+// writeAPIModelError maps the errors the models return to API errors.
+func writeAPIModelError(w http.ResponseWriter, err error) {
+	switch errs := fieldErrors(err); {
+	case errs != nil:
+		fields := make(map[string]string, len(errs))
+		for field, message := range errs {
+			if name, ok := apiFieldNames[field]; ok {
+				field = name
+			}
+			fields[field] = message
+		}
+		writeJSON(w, http.StatusBadRequest, apiErrorResponse{Error: apiError{Code: "invalid_input", Message: "Invalid input", Fields: fields}}) // 400
+	case errors.Is(err, models.ErrPostNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", "Post not found") // 404
+	case errors.Is(err, models.ErrCommentNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", "Comment not found") // 404
+	case errors.Is(err, models.ErrNotPostAuthor), errors.Is(err, models.ErrNotCommentAuthor):
+		writeAPIError(w, http.StatusForbidden, "forbidden", err.Error()) // 403
+	case errors.Is(err, models.ErrInvalidSort), errors.Is(err, models.ErrInvalidCursor):
+		writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error()) // 400
+	case errors.Is(err, errBadLink):
+		writeAPIError(w, http.StatusBadRequest, "invalid_token", "The token is invalid, was already used or has expired") // 400
+	case errors.Is(err, models.ErrTokenNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", "Token not found") // 404
+	case errors.Is(err, models.ErrInvalidScope):
+		writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error()) // 400
+	case errors.Is(err, models.ErrUserNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", "User not found") // 404
+	case errors.Is(err, models.ErrNoOpenReports):
+		writeAPIError(w, http.StatusNotFound, "not_found", "No open reports") // 404
+	case errors.Is(err, models.ErrAlreadyReported):
+		writeAPIError(w, http.StatusConflict, "conflict", err.Error()) // 409
+	case errors.Is(err, models.ErrReportReasonRequired):
+		writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error()) // 400
+	case errors.Is(err, models.ErrNotModerator), errors.Is(err, models.ErrNotAdmin), errors.Is(err, models.ErrOwnRole),
+		errors.Is(err, models.ErrPostLocked):
+		writeAPIError(w, http.StatusForbidden, "forbidden", err.Error()) // 403
+	case errors.Is(err, models.ErrInvalidAction), errors.Is(err, models.ErrInvalidRole), errors.Is(err, models.ErrReasonRequired):
+		writeAPIError(w, http.StatusBadRequest, "bad_request", err.Error()) // 400
+	case errors.Is(err, models.ErrUserExists):
+		writeAPIError(w, http.StatusConflict, "conflict", "Email or username already exists") // 409
+	default:
+		log.Println("API error:", err)
+		writeAPIError(w, http.StatusInternalServerError, "internal", "Internal server error") // 500
+	}
+}
+
+// decodeJSON reads the request body into dst. On failure it answers with a
+// 400 and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIBody))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body: "+err.Error()) // 400
+		return false
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		writeAPIError(w, http.StatusBadRequest, "invalid_json", "Invalid JSON body: trailing data") // 400
+		return false
+	}
+	return true
+}
+
+// pathID parses the {id} wildcard. On failure it answers with a 404 and
+// returns false.
+func pathID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Invalid ID in path") // 404
+		return 0, false
+	}
+	return id, true
+}
+
+// --- Auth ---
+
+// apiRegister creates an account and logs it in.
+func (app *App) apiRegister(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email    string `json:"email"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	user, err := app.registerUser(req.Email, req.Username, req.Password)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	app.apiIssueToken(w, r, user, http.StatusCreated)
+}
+
+// apiLogin exchanges a login (email or username) and password for a bearer
+// token. The token is a session like the cookie one and shows up on the
+// account page.
+func (app *App) apiLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	user, wait, err := app.checkLogin(r, req.Login, req.Password)
+	switch {
+	case errors.Is(err, errInvalidLogin):
+		writeAPIError(w, http.StatusUnauthorized, "invalid_login", "The username or password is incorrect") // 401
+		return
+	case errors.Is(err, models.ErrAccountLocked):
+		retryAfter(w, wait)
+		writeAPIError(w, http.StatusTooManyRequests, "account_locked", loginWaitMessage(wait, err)) // 429
+		return
+	case errors.Is(err, models.ErrLoginThrottled):
+		retryAfter(w, wait)
+		writeAPIError(w, http.StatusTooManyRequests, "login_throttled", loginWaitMessage(wait, err)) // 429
+		return
+	case err != nil:
+		writeAPIModelError(w, err)
+		return
+	}
+	app.apiIssueToken(w, r, user, http.StatusOK)
+}
+
+func (app *App) apiIssueToken(w http.ResponseWriter, r *http.Request, user *models.User, status int) {
+	session, err := app.startSession(r, user.ID)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	writeJSON(w, status, apiToken{
+		Token:     session.ID,
+		ExpiresAt: session.ExpiresAt.UTC(),
+		User:      selfAPIUser(user),
+	})
+}
+
+// apiLogout ends the session behind the bearer token (or cookie). A
+// personal access token is no session; it is revoked through the tokens
+// endpoint instead.
+func (app *App) apiLogout(w http.ResponseWriter, r *http.Request) {
+	if tokenScope(r) != "" {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "Personal access tokens are revoked with DELETE /api/v1/tokens/{id}") // 400
+		return
+	}
+	token, ok := bearerToken(r)
+	if !ok {
+		token = currentSessionID(r)
+	}
+	if err := app.Sessions.Delete(token); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (app *App) apiMe(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	writeJSON(w, http.StatusOK, selfAPIUser(user))
+}
+
+// selfAPIUser describes a user to themselves, with their email address.
+func selfAPIUser(user *models.User) apiUser {
+	return apiUser{ID: user.ID, Username: user.Username, Email: user.Email, Role: user.Role, EmailVerified: &user.EmailVerified}
+}
+
+// apiForgotPassword emails a password reset link. It answers 202 whether or
+// not the address is registered.
+func (app *App) apiForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	app.requestPasswordReset(req.Email)
+	w.WriteHeader(http.StatusAccepted) // 202
+}
+
+// apiResetPassword sets a new password with the token from a reset link. All
+// sessions and personal access tokens of the user end.
+func (app *App) apiResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := app.resetPassword(req.Token, req.Password); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// apiVerifyEmail verifies an email address with the token from a
+// verification link.
+func (app *App) apiVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Token string `json:"token"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if err := app.verifyEmail(req.Token); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// apiResendVerification emails the user a new verification link in the
+// background.
+func (app *App) apiResendVerification(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if user.EmailVerified {
+		writeAPIError(w, http.StatusConflict, "conflict", "Your email address is already verified") // 409
+		return
+	}
+	app.sendInBackground(app.verificationEmail(user), "verification")
+	w.WriteHeader(http.StatusAccepted) // 202
+}
+
+// --- Personal access tokens ---
+
+func toAPIPersonalToken(token models.APIToken) apiPersonalToken {
+	t := apiPersonalToken{ID: token.ID, Name: token.Name, Scope: token.Scope, CreatedAt: token.CreatedAt.UTC()}
+	if !token.LastUsedAt.IsZero() {
+		lastUsed := token.LastUsedAt.UTC()
+		t.LastUsedAt = &lastUsed
+	}
+	return t
+}
+
+func (app *App) apiListTokens(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	tokens, err := models.GetUserAPITokens(user.ID)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	apiTokens := []apiPersonalToken{}
+	for _, token := range tokens {
+		apiTokens = append(apiTokens, toAPIPersonalToken(token))
+	}
+	writeJSON(w, http.StatusOK, apiTokens)
+}
+
+// apiCreateToken issues a personal access token. The response is the only
+// place the token itself ever appears.
+func (app *App) apiCreateToken(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	var req struct {
+		Name  string `json:"name"`
+		Scope string `json:"scope"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "name is required") // 400
+		return
+	}
+
+	created, token, err := models.CreateAPIToken(user.ID, strings.TrimSpace(req.Name), req.Scope)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	t := toAPIPersonalToken(*created)
+	t.Token = token
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (app *App) apiDeleteToken(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	tokenID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := models.DeleteAPIToken(tokenID, user.ID); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
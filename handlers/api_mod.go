@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"Forum/models"
+	"net/http"
+)
+
+// modRequest is the body of the moderator endpoints. CategoryIDs is only
+// used by the move action and Role only by the role endpoint.
+type modRequest struct {
+	Reason      string `json:"reason"`
+	CategoryIDs []int  `json:"category_ids,omitempty"`
+	Role        string `json:"role,omitempty"`
+}
+
+// apiModLog returns the newest entries of the audit log.
+func (app *App) apiModLog(w http.ResponseWriter, r *http.Request) {
+	actions, err := models.GetModActions(modLogSize)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	entries := []apiModAction{}
+	for _, a := range actions {
+		entries = append(entries, apiModAction{
+			ID:        a.ID,
+			ActorID:   a.ActorID,
+			Actor:     a.Actor,
+			Action:    a.Action,
+			Target:    a.Target,
+			TargetID:  a.TargetID,
+			Reason:    a.Reason,
+			Details:   a.Details,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, entries)
+}
+
+// apiModeratePost applies hide, unhide, lock, unlock, move or delete to a
+// post.
+func (app *App) apiModeratePost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	postID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req modRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	action := r.PathValue("action") + "_post"
+	var err error
+	if action == models.ActionMovePost {
+		if len(req.CategoryIDs) == 0 {
+			writeAPIError(w, http.StatusBadRequest, "bad_request", "at least one category_ids entry is required") // 400
+			return
+		}
+		err = models.MovePost(user.ID, postID, req.CategoryIDs, req.Reason)
+	} else {
+		err = models.ModeratePost(user.ID, postID, action, req.Reason)
+	}
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+
+	if action == models.ActionDeletePost {
+		w.WriteHeader(http.StatusNoContent) // 204
+		return
+	}
+	app.writeAPIPost(w, r, postID, http.StatusOK)
+}
+
+// apiModerateComment applies hide, unhide or delete to a comment.
+func (app *App) apiModerateComment(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	commentID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req modRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.ModerateComment(user.ID, commentID, r.PathValue("action")+"_comment", req.Reason); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	app.writeAPIComment(w, r, commentID, http.StatusOK)
+}
+
+// apiSetUserRole gives a user another role. Admins only.
+func (app *App) apiSetUserRole(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req modRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.SetUserRole(user.ID, userID, req.Role, req.Reason); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	target, err := models.GetUserByID(userID)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiUser{ID: target.ID, Username: target.Username, Role: target.Role})
+}
+
+// apiUnlockUser lifts the lock failed logins put on an account. Admins only;
+// takes {"reason"}.
+func (app *App) apiUnlockUser(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	userID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req modRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.UnlockUser(user.ID, userID, req.Reason); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"Forum/models"
+	"net/http"
+	"strconv"
+)
+
+func toAPIPost(post models.Post) apiPost {
+	categories := []apiCategory{}
+	for _, category := range post.Category {
+		categories = append(categories, apiCategory{ID: category.ID, Name: category.Name})
+	}
+	return apiPost{
+		ID:         post.ID,
+		Title:      post.Title,
+		Content:    post.Content,
+		Author:     post.Author,
+		AuthorID:   post.UserID,
+		Categories: categories,
+		Score:      post.Score,
+		Hidden:     post.Hidden,
+		Locked:     post.Locked,
+		CreatedAt:  post.Created_at,
+		UpdatedAt:  post.Updated_at,
+	}
+}
+
+// reactionCounts lists the count of every reaction in the set, zeros
+// included, so clients see which reactions they can give.
+func (app *App) reactionCounts(reactions models.Reactions) map[string]int {
+	counts := make(map[string]int)
+	for _, reaction := range app.Config.Reactions {
+		counts[reaction.Name] = reactions.Counts[reaction.Name]
+	}
+	return counts
+}
+
+// toAPIComments converts a comment tree; reactions holds the counts from
+// models.GetPostReactions. The text of hidden comments is left out unless
+// moderator is set.
+func (app *App) toAPIComments(comments []models.Comment, reactions map[int]models.Reactions, moderator bool) []apiComment {
+	apiComments := []apiComment{}
+	for _, comment := range comments {
+		authorID, _ := strconv.Atoi(comment.User_ID)
+		apiComment := apiComment{
+			ID:         comment.ID,
+			PostID:     comment.PostID,
+			ParentID:   comment.ParentID,
+			Author:     comment.Author,
+			AuthorID:   authorID,
+			Content:    comment.Content,
+			CreatedAt:  comment.Created_at,
+			UpdatedAt:  comment.Updated_at,
+			Deleted:    comment.Deleted_at != "",
+			Hidden:     comment.Hidden,
+			Likes:      reactions[comment.ID].Likes,
+			Dislikes:   reactions[comment.ID].Dislikes,
+			Reactions:  app.reactionCounts(reactions[comment.ID]),
+			MyReaction: reactions[comment.ID].Mine,
+		}
+		if apiComment.Deleted {
+			apiComment.AuthorID = 0
+		}
+		if apiComment.Hidden && !moderator {
+			apiComment.Content = ""
+		}
+		if len(comment.Replies) > 0 {
+			apiComment.Replies = app.toAPIComments(comment.Replies, reactions, moderator)
+		}
+		apiComments = append(apiComments, apiComment)
+	}
+	return apiComments
+}
+
+// postRequest is the body of POST and PUT /api/v1/posts.
+type postRequest struct {
+	Title       string `json:"title"`
+	Content     string `json:"content"`
+	CategoryIDs []int  `json:"category_ids"`
+}
+
+// reactionRequest is the body of the reaction endpoints. Type names a
+// reaction from GET /api/v1/reactions; without it, value 1 likes, -1
+// dislikes and 0 takes the reaction back.
+type reactionRequest struct {
+	Type  string `json:"type"`
+	Value int    `json:"value"`
+}
+
+// reaction returns the reaction the request asks for, "" to remove it. On
+// failure it answers with a 400 and returns false.
+func (req reactionRequest) reaction(w http.ResponseWriter, app *App) (string, bool) {
+	reaction := req.Type
+	switch {
+	case req.Type != "" && req.Value != 0:
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "give either type or value, not both") // 400
+		return "", false
+	case req.Value == 1:
+		reaction = models.ReactionLike
+	case req.Value == -1:
+		reaction = models.ReactionDislike
+	case req.Value != 0:
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "value must be 1, -1 or 0") // 400
+		return "", false
+	}
+	if reaction != "" && !app.Config.HasReaction(reaction) {
+		writeAPIError(w, http.StatusBadRequest, "bad_request", "Unknown reaction "+reaction) // 400
+		return "", false
+	}
+	return reaction, true
+}
+
+func (app *App) apiListReactions(w http.ResponseWriter, r *http.Request) {
+	reactions := []apiReaction{}
+	for _, reaction := range app.Config.Reactions {
+		reactions = append(reactions, apiReaction{Name: reaction.Name, Emoji: reaction.Emoji})
+	}
+	writeJSON(w, http.StatusOK, reactions)
+}
+
+func (app *App) apiListCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := models.GetAllCategories()
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	apiCategories := []apiCategory{}
+	for _, category := range categories {
+		apiCategories = append(apiCategories, apiCategory{ID: category.ID, Name: category.Name})
+	}
+	writeJSON(w, http.StatusOK, apiCategories)
+}
+
+// apiListPosts takes the same sort, before, after and limit parameters as
+// the HTML listings, plus category and author IDs to filter by.
+func (app *App) apiListPosts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := models.PostQuery{
+		Sort:   query.Get("sort"),
+		Before: query.Get("before"),
+		After:  query.Get("after"),
+	}
+	for param, dst := range map[string]*int{"limit": &q.Limit, "category": &q.CategoryID, "author": &q.AuthorID} {
+		if v := query.Get(param); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				writeAPIError(w, http.StatusBadRequest, "bad_request", "Invalid "+param) // 400
+				return
+			}
+			*dst = n
+		}
+	}
+
+	page, err := models.ListPosts(q)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	list := apiPostList{Posts: []apiPost{}, Next: page.Next, Prev: page.Prev}
+	for _, post := range page.Posts {
+		list.Posts = append(list.Posts, toAPIPost(post))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (app *App) apiGetPost(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	app.writeAPIPost(w, r, postID, http.StatusOK)
+}
+
+// visiblePost loads a post the caller may see: hidden posts are only shown
+// to moderators.
+func visiblePost(r *http.Request, id string) (*models.Post, error) {
+	post, err := models.GetPostByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if post.Hidden && !isModerator(r) {
+		return nil, models.ErrPostNotFound
+	}
+	return post, nil
+}
+
+func (app *App) writeAPIPost(w http.ResponseWriter, r *http.Request, postID, status int) {
+	id := strconv.Itoa(postID)
+	post, err := visiblePost(r, id)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	reactions, _, err := models.GetPostReactions(id, viewerID(r))
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	writeJSON(w, status, apiPostDetail{
+		apiPost:    toAPIPost(*post),
+		Likes:      reactions.Likes,
+		Dislikes:   reactions.Dislikes,
+		Reactions:  app.reactionCounts(reactions),
+		MyReaction: reactions.Mine,
+	})
+}
+
+func (app *App) apiCreatePost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	var req postRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	postID, err := models.CreatePost(user.ID, req.Title, req.Content, req.CategoryIDs)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/posts/"+strconv.Itoa(postID))
+	app.writeAPIPost(w, r, postID, http.StatusCreated)
+}
+
+func (app *App) apiUpdatePost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	postID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req postRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.UpdatePost(postID, user.ID, req.Title, req.Content, req.CategoryIDs); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	app.writeAPIPost(w, r, postID, http.StatusOK)
+}
+
+func (app *App) apiDeletePost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	postID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := models.DeletePost(postID, user.ID); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (app *App) apiReactToPost(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	postID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req reactionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	reaction, ok := req.reaction(w, app)
+	if !ok {
+		return
+	}
+	if err := models.SetReaction(postID, user.ID, reaction); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	app.writeAPIPost(w, r, postID, http.StatusOK)
+}
+
+// apiListComments returns the comment tree of a post.
+func (app *App) apiListComments(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	id := strconv.Itoa(postID)
+	if _, err := visiblePost(r, id); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	comments, err := models.GetCommentTree(id, app.Config.MaxCommentDepth)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	_, reactions, err := models.GetPostReactions(id, viewerID(r))
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, app.toAPIComments(comments, reactions, isModerator(r)))
+}
+
+func (app *App) apiCreateComment(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	postID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Content  string `json:"content"`
+		ParentID int    `json:"parent_id"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	id := strconv.Itoa(postID)
+	if _, err := visiblePost(r, id); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+
+	commentID, err := models.CreateComment(user.ID, id, req.Content, req.ParentID)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	app.writeAPIComment(w, r, commentID, http.StatusCreated)
+}
+
+func (app *App) writeAPIComment(w http.ResponseWriter, r *http.Request, commentID, status int) {
+	comment, err := models.GetCommentByID(commentID)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	_, reactions, err := models.GetPostReactions(strconv.Itoa(comment.PostID), viewerID(r))
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	writeJSON(w, status, app.toAPIComments([]models.Comment{*comment}, reactions, isModerator(r))[0])
+}
+
+func (app *App) apiUpdateComment(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	commentID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		Content string `json:"content"`
+	}
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.UpdateComment(commentID, user.ID, req.Content); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	app.writeAPIComment(w, r, commentID, http.StatusOK)
+}
+
+func (app *App) apiDeleteComment(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	commentID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	if err := models.DeleteComment(commentID, user.ID); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+func (app *App) apiReactToComment(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	commentID, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req reactionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	reaction, ok := req.reaction(w, app)
+	if !ok {
+		return
+	}
+	if err := models.SetCommentReaction(commentID, user.ID, reaction); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	app.writeAPIComment(w, r, commentID, http.StatusOK)
+}
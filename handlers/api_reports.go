@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"Forum/models"
+	"net/http"
+)
+
+// reportRequest is the body of the report endpoints and of resolving
+// reports; Resolution is only used by the latter.
+type reportRequest struct {
+	Reason     string `json:"reason"`
+	Resolution string `json:"resolution,omitempty"`
+}
+
+// apiReportPost files a report of a post. The response says whether the
+// report hid the post.
+func (app *App) apiReportPost(w http.ResponseWriter, r *http.Request) {
+	app.apiReport(w, r, models.ReportPost)
+}
+
+func (app *App) apiReportComment(w http.ResponseWriter, r *http.Request) {
+	app.apiReport(w, r, models.ReportComment)
+}
+
+func (app *App) apiReport(w http.ResponseWriter, r *http.Request, report func(reporterID, id int, reason string, threshold int) (bool, error)) {
+	user := currentUser(r)
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req reportRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	hidden, err := report(user.ID, id, req.Reason, app.Config.ReportThreshold)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]bool{"hidden": hidden})
+}
+
+// apiReportQueue returns everything with open reports, the most reported
+// first.
+func (app *App) apiReportQueue(w http.ResponseWriter, r *http.Request) {
+	queue, err := models.GetReportQueue()
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	items := []apiReportedItem{}
+	for _, item := range queue {
+		reports := []apiReport{}
+		for _, report := range item.Reports {
+			reports = append(reports, apiReport{Reporter: report.Reporter, Reason: report.Reason, CreatedAt: report.CreatedAt})
+		}
+		items = append(items, apiReportedItem{
+			Target:   item.Target,
+			TargetID: item.TargetID,
+			PostID:   item.PostID,
+			Title:    item.Title,
+			Content:  item.Content,
+			Author:   item.Author,
+			Hidden:   item.Hidden,
+			Deleted:  item.Deleted,
+			Reports:  reports,
+		})
+	}
+	writeJSON(w, http.StatusOK, items)
+}
+
+// apiResolveReports closes the open reports on a post or comment with
+// {"resolution": "resolved" or "dismissed", "reason"}.
+func (app *App) apiResolveReports(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	id, ok := pathID(w, r)
+	if !ok {
+		return
+	}
+	var req reportRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := models.ResolveReports(user.ID, r.PathValue("target"), id, req.Resolution, req.Reason); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// apiListNotifications returns the caller's newest notifications. Reading
+// them doesn't mark them read; POST /api/v1/notifications/read does.
+func (app *App) apiListNotifications(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	notifications, err := models.GetNotifications(user.ID, notificationsShown)
+	if err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	list := []apiNotification{}
+	for _, n := range notifications {
+		list = append(list, apiNotification{ID: n.ID, Message: n.Message, Link: n.Link, CreatedAt: n.CreatedAt, Read: n.Read})
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (app *App) apiReadNotifications(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if err := models.MarkNotificationsRead(user.ID); err != nil {
+		writeAPIModelError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"Forum/config"
+	"Forum/models"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// apiTest drives the JSON API of an App on a fresh database.
+type apiTest struct {
+	t       *testing.T
+	app     *App
+	handler http.Handler
+}
+
+func newAPITest(t *testing.T) *apiTest {
+	t.Helper()
+	models.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	t.Cleanup(func() { models.CloseDB() })
+
+	cfg, err := config.Load([]string{
+		"-templates", "../templates",
+		"-bcrypt-cost", "4",
+		"-csrf-key", "test key",
+		"-rate-login", "off",
+		"-rate-post", "off",
+		"-rate-comment", "off",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app, err := New(cfg, NewMemorySessionStore(), &captureMailer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { app.WaitForMail(context.Background()) })
+	return &apiTest{t: t, app: app, handler: app.Routes()}
+}
+
+// do sends a request with body encoded as JSON, authenticated with token
+// unless it is empty, and decodes the response into out if it isn't nil. It
+// returns the status code.
+func (a *apiTest) do(method, path, token string, body, out interface{}) int {
+	a.t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			a.t.Fatal(err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	a.handler.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			a.t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+// expect checks the status and, for errors, the error code of a request.
+func (a *apiTest) expect(method, path, token string, body interface{}, status int, code string) {
+	a.t.Helper()
+	var resp apiErrorResponse
+	var out interface{}
+	if code != "" {
+		out = &resp
+	}
+	if got := a.do(method, path, token, body, out); got != status {
+		a.t.Errorf("%s %s: status %d, want %d", method, path, got, status)
+	}
+	if resp.Error.Code != code {
+		a.t.Errorf("%s %s: error code %q, want %q", method, path, resp.Error.Code, code)
+	}
+}
+
+// register creates an account and returns its session token.
+func (a *apiTest) register(name string) string {
+	a.t.Helper()
+	var resp apiToken
+	body := map[string]string{"email": name + "@example.com", "username": name, "password": "password1"}
+	if status := a.do("POST", "/api/v1/auth/register", "", body, &resp); status != http.StatusCreated {
+		a.t.Fatalf("registering %s: status %d", name, status)
+	}
+	return resp.Token
+}
+
+func (a *apiTest) createPost(token string) int {
+	a.t.Helper()
+	var post apiPostDetail
+	body := map[string]interface{}{"title": "Title", "content": "Content", "category_ids": []int{1}}
+	if status := a.do("POST", "/api/v1/posts", token, body, &post); status != http.StatusCreated {
+		a.t.Fatalf("creating a post: status %d", status)
+	}
+	return post.ID
+}
+
+func TestAPIAuth(t *testing.T) {
+	a := newAPITest(t)
+	token := a.register("alice")
+
+	a.expect("POST", "/api/v1/auth/register", "", map[string]string{"email": "alice@example.com", "username": "alice", "password": "password1"}, http.StatusConflict, "conflict")
+	var invalid apiErrorResponse
+	if status := a.do("POST", "/api/v1/auth/register", "", map[string]string{"email": "x", "username": "bob", "password": "password1"}, &invalid); status != http.StatusBadRequest || invalid.Error.Fields["email"] == "" {
+		t.Errorf("invalid email: status %d, %+v", status, invalid.Error)
+	}
+	a.expect("POST", "/api/v1/auth/register", "", map[string]string{"unknown": "field"}, http.StatusBadRequest, "invalid_json")
+
+	var login apiToken
+	if status := a.do("POST", "/api/v1/auth/login", "", map[string]string{"login": "alice@example.com", "password": "password1"}, &login); status != http.StatusOK || login.User.Username != "alice" {
+		t.Fatalf("login: status %d, %+v", status, login)
+	}
+	a.expect("POST", "/api/v1/auth/login", "", map[string]string{"login": "nobody", "password": "password1"}, http.StatusUnauthorized, "invalid_login")
+	a.expect("POST", "/api/v1/auth/login", "", map[string]string{"login": "alice", "password": "wrong password"}, http.StatusUnauthorized, "invalid_login")
+	// The next try has to wait
+	a.expect("POST", "/api/v1/auth/login", "", map[string]string{"login": "alice", "password": "password1"}, http.StatusTooManyRequests, "login_throttled")
+
+	a.expect("GET", "/api/v1/me", "", nil, http.StatusUnauthorized, "unauthorized")
+	a.expect("GET", "/api/v1/me", "not a token", nil, http.StatusUnauthorized, "unauthorized")
+	var me apiUser
+	if status := a.do("GET", "/api/v1/me", token, nil, &me); status != http.StatusOK || me.Username != "alice" || me.Email != "alice@example.com" {
+		t.Errorf("me: status %d, %+v", status, me)
+	}
+	a.expect("GET", "/api/v1/nothing", token, nil, http.StatusNotFound, "not_found")
+
+	// A new verification link goes out in the background and works
+	a.expect("POST", "/api/v1/me/verify-email", token, nil, http.StatusAccepted, "")
+	link := a.app.Mailer.(*captureMailer).lastToken(t, a.app)
+	a.expect("POST", "/api/v1/auth/verify-email", "", map[string]string{"token": link}, http.StatusNoContent, "")
+	a.expect("POST", "/api/v1/me/verify-email", token, nil, http.StatusConflict, "conflict")
+
+	// Logging out ends only that session
+	a.expect("POST", "/api/v1/auth/logout", login.Token, nil, http.StatusNoContent, "")
+	a.expect("GET", "/api/v1/me", login.Token, nil, http.StatusUnauthorized, "unauthorized")
+	a.expect("GET", "/api/v1/me", token, nil, http.StatusOK, "")
+}
+
+func TestAPIPersonalAccessTokens(t *testing.T) {
+	a := newAPITest(t)
+	session := a.register("alice")
+
+	var created apiPersonalToken
+	if status := a.do("POST", "/api/v1/tokens", session, map[string]string{"name": "bot", "scope": models.ScopeRead}, &created); status != http.StatusCreated || created.Token == "" {
+		t.Fatalf("creating a token: status %d, %+v", status, created)
+	}
+	a.expect("POST", "/api/v1/tokens", session, map[string]string{"name": "bot", "scope": "root"}, http.StatusBadRequest, "bad_request")
+
+	// A read token reads, but can't write or manage the account
+	pat := created.Token
+	a.expect("GET", "/api/v1/me", pat, nil, http.StatusOK, "")
+	a.expect("POST", "/api/v1/posts", pat, map[string]interface{}{"title": "T", "content": "C", "category_ids": []int{1}}, http.StatusForbidden, "insufficient_scope")
+	a.expect("GET", "/api/v1/tokens", pat, nil, http.StatusForbidden, "insufficient_scope")
+
+	// Logging out doesn't revoke a token; deleting it does
+	var writer apiPersonalToken
+	a.do("POST", "/api/v1/tokens", session, map[string]string{"name": "writer", "scope": models.ScopePost}, &writer)
+	a.expect("POST", "/api/v1/auth/logout", writer.Token, nil, http.StatusBadRequest, "bad_request")
+	a.expect("GET", "/api/v1/me", writer.Token, nil, http.StatusOK, "")
+
+	path := "/api/v1/tokens/" + strconv.Itoa(created.ID)
+	a.expect("DELETE", path, a.register("bob"), nil, http.StatusNotFound, "not_found")
+	a.expect("DELETE", path, session, nil, http.StatusNoContent, "")
+	a.expect("GET", "/api/v1/me", pat, nil, http.StatusUnauthorized, "unauthorized")
+}
+
+func TestAPIPostOwnership(t *testing.T) {
+	a := newAPITest(t)
+	alice, bob := a.register("alice"), a.register("bob")
+	postID := a.createPost(alice)
+	path := "/api/v1/posts/" + strconv.Itoa(postID)
+	edit := map[string]interface{}{"title": "Edited", "content": "Content", "category_ids": []int{1}}
+
+	a.expect("POST", "/api/v1/posts", "", edit, http.StatusUnauthorized, "unauthorized")
+	a.expect("POST", "/api/v1/posts", alice, map[string]interface{}{"title": " ", "content": "Content"}, http.StatusBadRequest, "invalid_input")
+	a.expect("PUT", path, bob, edit, http.StatusForbidden, "forbidden")
+	a.expect("DELETE", path, bob, nil, http.StatusForbidden, "forbidden")
+	var post apiPostDetail
+	if status := a.do("PUT", path, alice, edit, &post); status != http.StatusOK || post.Title != "Edited" {
+		t.Errorf("author editing: status %d, %+v", status, post)
+	}
+	a.expect("GET", "/api/v1/posts/999", "", nil, http.StatusNotFound, "not_found")
+	a.expect("GET", "/api/v1/posts/abc", "", nil, http.StatusNotFound, "not_found")
+
+	// Comments belong to their authors just the same
+	var comment apiComment
+	if status := a.do("POST", path+"/comments", bob, map[string]string{"content": "Nice"}, &comment); status != http.StatusCreated {
+		t.Fatalf("commenting: status %d", status)
+	}
+	commentPath := "/api/v1/comments/" + strconv.Itoa(comment.ID)
+	a.expect("PUT", commentPath, alice, map[string]string{"content": "Not nice"}, http.StatusForbidden, "forbidden")
+	a.expect("DELETE", commentPath, alice, nil, http.StatusForbidden, "forbidden")
+	a.expect("PUT", commentPath, bob, map[string]string{"content": "Very nice"}, http.StatusOK, "")
+	a.expect("POST", "/api/v1/posts/999/comments", bob, map[string]string{"content": "Hello?"}, http.StatusNotFound, "not_found")
+
+	a.expect("DELETE", path, alice, nil, http.StatusNoContent, "")
+	a.expect("GET", path, "", nil, http.StatusNotFound, "not_found")
+}
+
+func TestAPIHiddenPosts(t *testing.T) {
+	a := newAPITest(t)
+	author, mod := a.register("author"), a.register("mod")
+	if err := models.SetUserRoleByName("mod", models.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	postID := a.createPost(author)
+	path := "/api/v1/posts/" + strconv.Itoa(postID)
+	reason := map[string]string{"reason": "spam"}
+
+	a.expect("POST", "/api/v1/mod/posts/"+strconv.Itoa(postID)+"/hide", author, reason, http.StatusForbidden, "forbidden")
+	a.expect("POST", "/api/v1/mod/posts/"+strconv.Itoa(postID)+"/hide", mod, map[string]string{}, http.StatusBadRequest, "bad_request")
+	a.expect("POST", "/api/v1/mod/posts/"+strconv.Itoa(postID)+"/hide", mod, reason, http.StatusOK, "")
+	a.expect("POST", "/api/v1/mod/posts/"+strconv.Itoa(postID)+"/move", mod, map[string]interface{}{"reason": "tidy", "category_ids": []int{99}}, http.StatusBadRequest, "invalid_input")
+
+	// Only moderators see a hidden post, and nobody can comment on it unseen
+	a.expect("GET", path, "", nil, http.StatusNotFound, "not_found")
+	a.expect("GET", path, author, nil, http.StatusNotFound, "not_found")
+	a.expect("POST", path+"/comments", author, map[string]string{"content": "Why?"}, http.StatusNotFound, "not_found")
+	var post apiPostDetail
+	if status := a.do("GET", path, mod, nil, &post); status != http.StatusOK || !post.Hidden {
+		t.Errorf("moderator: status %d, hidden %v", status, post.Hidden)
+	}
+	var list apiPostList
+	a.do("GET", "/api/v1/posts", "", nil, &list)
+	if len(list.Posts) != 0 {
+		t.Errorf("listing shows %d posts, want the hidden one left out", len(list.Posts))
+	}
+}
+
+func TestAPIReports(t *testing.T) {
+	a := newAPITest(t)
+	author, reporter := a.register("author"), a.register("reporter")
+	path := "/api/v1/posts/" + strconv.Itoa(a.createPost(author)) + "/report"
+
+	a.expect("POST", path, "", map[string]string{"reason": "spam"}, http.StatusUnauthorized, "unauthorized")
+	a.expect("POST", path, reporter, map[string]string{"reason": strings.Repeat("x", models.MaxReasonLength+1)}, http.StatusBadRequest, "invalid_input")
+	a.expect("POST", path, reporter, map[string]string{"reason": "spam"}, http.StatusCreated, "")
+	a.expect("POST", path, reporter, map[string]string{"reason": "spam"}, http.StatusConflict, "conflict")
+
+	// Every try counts against the report budget, refused ones too
+	for i := 3; i < a.app.Config.RateReport.Count; i++ {
+		a.do("POST", path, reporter, map[string]string{"reason": "spam"}, nil)
+	}
+	a.expect("POST", path, reporter, map[string]string{"reason": "spam"}, http.StatusTooManyRequests, "rate_limited")
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"Forum/config"
+	"crypto/rand"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// App holds everything the handlers need: the configuration, the session
+// store and the parsed templates.
+type App struct {
+	Config    *config.Config
+	Sessions  SessionStore
+	Limiter   RateLimiter
+	Mailer    Mailer
+	templates *template.Template
+	csrfKey   []byte
+	linkKey   []byte         // signs the links in password reset and verification emails
+	mailing   sync.WaitGroup // emails being sent in the background
+	dummyHash []byte         // compared against for logins naming no account
+}
+
+// New parses the templates in cfg.TemplateDir and returns an App using the
+// given session store and mailer.
+func New(cfg *config.Config, sessions SessionStore, mailer Mailer) (*App, error) {
+	templates, err := template.ParseGlob(filepath.Join(cfg.TemplateDir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	csrfKey := []byte(cfg.CSRFKey)
+	if len(csrfKey) == 0 {
+		csrfKey = make([]byte, 32)
+		if _, err := rand.Read(csrfKey); err != nil {
+			return nil, fmt.Errorf("failed to generate CSRF key: %w", err)
+		}
+		log.Println("No CSRF key configured; open forms stop working after a restart")
+	}
+	linkKey := []byte(cfg.LinkKey)
+	if len(linkKey) == 0 {
+		linkKey = make([]byte, 32)
+		if _, err := rand.Read(linkKey); err != nil {
+			return nil, fmt.Errorf("failed to generate link key: %w", err)
+		}
+		log.Println("No link key configured; emailed password reset and verification links stop working after a restart and on other instances")
+	}
+	// Logins naming no account still pay for a bcrypt compare, so how long
+	// one takes doesn't tell whether the account exists
+	dummyHash, err := bcrypt.GenerateFromPassword([]byte("not a password"), cfg.BcryptCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash the dummy password: %w", err)
+	}
+	return &App{
+		Config:    cfg,
+		Sessions:  sessions,
+		Limiter:   NewMemoryRateLimiter(),
+		Mailer:    mailer,
+		templates: templates,
+		csrfKey:   csrfKey,
+		linkKey:   deriveKey(linkKey, "email links"),
+		dummyHash: dummyHash,
+	}, nil
+}
+
+// Routes registers every handler on a new mux, wrapped in the CSRF check.
+func (app *App) Routes() http.Handler {
+	mux := http.NewServeMux()
+	// Pages anyone can see
+	mux.HandleFunc("/", app.HomeHandler)
+	mux.HandleFunc("/home", app.HomeHandler)
+	mux.HandleFunc("/register", app.RateLimit("login", app.RegisterHandler))
+	mux.HandleFunc("/login", app.RateLimit("login", app.LoginHandler))
+	mux.HandleFunc("/Post", app.ViewPostHandler)
+	mux.HandleFunc("/CategoryViewer", app.CatagoryHandler)
+	mux.HandleFunc("/search", app.SearchHandler)
+	mux.HandleFunc("/forgot-password", app.RateLimit("login", app.ForgotPasswordHandler))
+	mux.HandleFunc("/reset-password", app.RateLimit("login", app.ResetPasswordHandler))
+	mux.HandleFunc("/verify-email", app.VerifyEmailHandler)
+
+	// JSON API; it checks authentication per route
+	mux.Handle("/api/v1/", app.apiRoutes())
+
+	// Everything that changes state or belongs to a user needs a session
+	mux.HandleFunc("/logout", app.RequireAuth(app.LogoutHandler))
+	mux.HandleFunc("/createPost", app.RequireAuth(app.RequireVerified(app.RateLimit("post", app.CreatePostHandler))))
+	mux.HandleFunc("/post/edit", app.RequireAuth(app.EditPostHandler))
+	mux.HandleFunc("/post/delete", app.RequireAuth(app.DeletePostHandler))
+	mux.HandleFunc("/myposts", app.RequireAuth(app.CreatedPostsHandler))
+	mux.HandleFunc("/LikedPosts", app.RequireAuth(app.LikedPostsHandler))
+	mux.HandleFunc("/Comment", app.RequireAuth(app.RequireVerified(app.RateLimit("comment", app.CommentHandler))))
+	mux.HandleFunc("/comment/edit", app.RequireAuth(app.EditCommentHandler))
+	mux.HandleFunc("/comment/delete", app.RequireAuth(app.DeleteCommentHandler))
+	mux.HandleFunc("/Like", app.RequireAuth(app.RateLimit("reaction", app.LikeHandler)))
+	mux.HandleFunc("/CommentLike", app.RequireAuth(app.RateLimit("reaction", app.LikeCommentHandler)))
+	mux.HandleFunc("/report", app.RequireAuth(app.RateLimit("report", app.ReportHandler)))
+	mux.HandleFunc("/notifications", app.RequireAuth(app.NotificationsHandler))
+	mux.HandleFunc("/account", app.RequireSession(app.AccountHandler))
+	mux.HandleFunc("/account/sessions/revoke", app.RequireSession(app.RevokeSessionHandler))
+	mux.HandleFunc("/account/sessions/revoke-all", app.RequireSession(app.RevokeAllSessionsHandler))
+	mux.HandleFunc("/account/tokens", app.RequireSession(app.CreateTokenHandler))
+	mux.HandleFunc("/account/tokens/revoke", app.RequireSession(app.RevokeTokenHandler))
+	mux.HandleFunc("/account/verify-email", app.RequireSession(app.RateLimit("login", app.ResendVerificationHandler)))
+
+	// Moderator tools
+	mux.HandleFunc("/mod", app.RequireModerator(app.ModHandler))
+	mux.HandleFunc("/mod/post", app.RequireModerator(app.ModPostHandler))
+	mux.HandleFunc("/mod/comment", app.RequireModerator(app.ModCommentHandler))
+	mux.HandleFunc("/mod/user", app.RequireModerator(app.ModUserHandler))
+	mux.HandleFunc("/mod/unlock", app.RequireModerator(app.UnlockUserHandler))
+	mux.HandleFunc("/mod/reports", app.RequireModerator(app.ReportQueueHandler))
+	mux.HandleFunc("/mod/reports/resolve", app.RequireModerator(app.ResolveReportHandler))
+
+	// Serve static files
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir(app.Config.StaticDir))))
+	return app.CSRF(app.LoadUser(mux))
+}
+
+// renderTemplate helper function
+// Page data maps get a CSRFToken entry so every form can carry the token, an
+// IsModerator entry for the moderation link and the Unread notification count.
+func (app *App) RenderTemplate(w http.ResponseWriter, r *http.Request, tmpl string, data interface{}) {
+	switch pageData := data.(type) {
+	case map[string]interface{}:
+		pageData["CSRFToken"] = csrfToken(r)
+		pageData["IsModerator"] = isModerator(r)
+		pageData["Unread"] = unreadNotifications(r)
+	case nil:
+		data = map[string]interface{}{"CSRFToken": csrfToken(r), "IsModerator": isModerator(r), "Unread": unreadNotifications(r)}
+	}
+
+	// Check if the requested template exists
+	if app.templates.Lookup(tmpl+".html") == nil {
+		// Render the 404 error page if the requested template is missing and 404 page exists
+		if app.templates.Lookup("404.html") == nil || app.templates.ExecuteTemplate(w, "404.html", nil) != nil {
+			// If rendering 404 template fails, fallback to default 404 message
+			http.Error(w, "404 page not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	// Attempt to execute the requested template
+	err := app.templates.ExecuteTemplate(w, tmpl+".html", data)
+	if err != nil {
+		log.Print(err)
+
+		// Render the 500 error page if there's an internal server error
+		err500 := app.templates.ExecuteTemplate(w, "500.html", nil)
+		if err500 != nil {
+			// If rendering 500 template fails, fallback to default 500 message
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// EditCommentHandler replaces the text of a comment on behalf of its author.
+func (app *App) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.FormValue("comment_id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid comment", http.StatusBadRequest) // 400
+		return
+	}
+	content := r.FormValue("comment")
+
+	if err := models.UpdateComment(commentID, user.ID, content); err != nil {
+		app.commentError(w, r, err)
+		return
+	}
+	app.redirectToCommentPost(w, r, commentID)
+}
+
+// DeleteCommentHandler turns a comment into a "[deleted]" tombstone on behalf
+// of its author.
+func (app *App) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.FormValue("comment_id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid comment", http.StatusBadRequest) // 400
+		return
+	}
+
+	if err := models.DeleteComment(commentID, user.ID); err != nil {
+		app.commentError(w, r, err)
+		return
+	}
+	app.redirectToCommentPost(w, r, commentID)
+}
+
+// redirectToCommentPost sends the user back to the post a comment belongs to.
+func (app *App) redirectToCommentPost(w http.ResponseWriter, r *http.Request, commentID int) {
+	comment, err := models.GetCommentByID(commentID)
+	if err != nil {
+		http.Redirect(w, r, "/", http.StatusSeeOther) // 303
+		return
+	}
+	http.Redirect(w, r, "/Post?id="+strconv.Itoa(comment.PostID), http.StatusSeeOther) // 303
+}
+
+// commentError answers a failed UpdateComment or DeleteComment.
+func (app *App) commentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch errs := fieldErrors(err); {
+	case errs != nil:
+		http.Error(w, "Bad request: "+errs["comment"], http.StatusBadRequest) // 400
+	case errors.Is(err, models.ErrCommentNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+		app.RenderTemplate(w, r, "404", nil)
+	case errors.Is(err, models.ErrNotCommentAuthor):
+		http.Error(w, "Forbidden: you can only change your own comments", http.StatusForbidden) // 403
+	default:
+		log.Println("Error changing comment:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+	}
+}
+
+// commentDetails turns a comment tree into the nested maps viewPost.html
+// renders with its "comment" template. Each entry carries the CSRF token
+// because the nested template can't reach the page data. reactions holds the
+// counts from models.GetPostReactions. Only moderators get the text of
+// hidden comments; locked leaves out the reply forms.
+func (app *App) commentDetails(r *http.Request, postID string, locked bool, comments []models.Comment, reactions map[int]models.Reactions) []map[string]interface{} {
+	user := currentUser(r)
+	isLoggedIn := user != nil
+	moderator := isModerator(r)
+
+	var CommentDetails []map[string]interface{}
+	for _, comment := range comments {
+		commentDetail := map[string]interface{}{
+			"PostID":        postID,
+			"id":            comment.ID,
+			"Author":        comment.Author,
+			"comment":       comment.Content,
+			"created_at":    comment.Created_at,
+			"CommentUserID": comment.User_ID,
+			"updated_at":    comment.Updated_at,
+			"Deleted":       comment.Deleted_at != "",
+			"Hidden":        comment.Hidden,
+			"IsAuthor":      isLoggedIn && comment.User_ID == strconv.Itoa(user.ID),
+			"IsLoggedIn":    isLoggedIn,
+			"IsModerator":   moderator,
+			"Locked":        locked,
+			"Reactions":     app.reactionButtons(reactions[comment.ID]),
+			"Replies":       app.commentDetails(r, postID, locked, comment.Replies, reactions),
+			"ReplyCount":    countReplies(comment.Replies),
+			"CSRFToken":     csrfToken(r),
+		}
+		if comment.Hidden && !moderator {
+			commentDetail["comment"] = ""
+		}
+		CommentDetails = append(CommentDetails, commentDetail)
+	}
+	return CommentDetails
+}
+
+// countReplies counts every comment in a sub-thread.
+func countReplies(replies []models.Comment) int {
+	n := len(replies)
+	for _, reply := range replies {
+		n += countReplies(reply.Replies)
+	}
+	return n
+}
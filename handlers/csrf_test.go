@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	app := &App{csrfKey: []byte("test key")}
+	var passedToken string
+	handler := app.CSRF(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		passedToken = csrfToken(r)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// request sends method to path with the given cookies; a non-empty
+	// token goes in the form, or in the header for API paths.
+	request := func(method, path, token string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		var r *http.Request
+		if token != "" && !strings.HasPrefix(path, "/api/") {
+			r = httptest.NewRequest(method, path, strings.NewReader(url.Values{csrfFieldName: {token}}.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(method, path, nil)
+			if token != "" {
+				r.Header.Set(csrfHeaderName, token)
+			}
+		}
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	session := &http.Cookie{Name: sessionCookieName, Value: "session-a"}
+	visitor := &http.Cookie{Name: csrfCookieName, Value: "visitor-a"}
+
+	// A GET passes and hands a new visitor an ID and the matching token
+	w := request(http.MethodGet, "/login", "")
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("GET: status %d, want it passed through", w.Code)
+	}
+	var issued *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == csrfCookieName {
+			issued = cookie
+		}
+	}
+	if issued == nil || passedToken != app.sign(issued.Value) {
+		t.Fatalf("GET: cookie %v, token %q", issued, passedToken)
+	}
+	if w := request(http.MethodPost, "/login", passedToken, issued); w.Code != http.StatusNoContent {
+		t.Errorf("form with the issued token: status %d", w.Code)
+	}
+
+	tests := []struct {
+		name, method, path, token string
+		cookie                    *http.Cookie
+		want                      int
+	}{
+		{"no token", http.MethodPost, "/createPost", "", session, http.StatusForbidden},
+		{"garbage token", http.MethodPost, "/createPost", "garbage", session, http.StatusForbidden},
+		{"another session's token", http.MethodPost, "/createPost", app.sign("session-b"), session, http.StatusForbidden},
+		{"another visitor's token", http.MethodPost, "/login", app.sign("visitor-b"), visitor, http.StatusForbidden},
+		{"valid form token", http.MethodPost, "/createPost", app.sign("session-a"), session, http.StatusNoContent},
+		{"valid visitor token", http.MethodPost, "/login", app.sign("visitor-a"), visitor, http.StatusNoContent},
+		{"other methods", http.MethodDelete, "/createPost", "", session, http.StatusForbidden},
+		{"HEAD", http.MethodHead, "/createPost", "", session, http.StatusNoContent},
+		// The API checks the header when a browser session comes along
+		{"API with a session cookie", http.MethodPost, "/api/v1/posts", "", session, http.StatusForbidden},
+		{"API with a session cookie and header", http.MethodPost, "/api/v1/posts", app.sign("session-a"), session, http.StatusNoContent},
+		{"API without cookies", http.MethodPost, "/api/v1/posts", "", nil, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		var cookies []*http.Cookie
+		if tt.cookie != nil {
+			cookies = append(cookies, tt.cookie)
+		}
+		if w := request(tt.method, tt.path, tt.token, cookies...); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	// A bearer token is exempt even when the browser's cookie comes along
+	for _, path := range []string{"/api/v1/posts", "/createPost"} {
+		r := httptest.NewRequest(http.MethodPost, path, nil)
+		r.Header.Set("Authorization", "Bearer some-token")
+		r.AddCookie(session)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusNoContent {
+			t.Errorf("bearer token on %s: status %d, want it exempt", path, w.Code)
+		}
+	}
+
+	// API clients are told what went wrong in JSON
+	w = request(http.MethodPost, "/api/v1/posts", "", session)
+	if !strings.Contains(w.Body.String(), `"invalid_csrf_token"`) {
+		t.Errorf("API refusal body %q", w.Body.String())
+	}
+}
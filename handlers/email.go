@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"Forum/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// What an emailed link is for. A link token only works for its own purpose.
+const (
+	linkResetPassword = "reset-password"
+	linkVerifyEmail   = "verify-email"
+)
+
+const (
+	resetLinkLifetime  = time.Hour
+	verifyLinkLifetime = 7 * 24 * time.Hour
+)
+
+var errBadLink = errors.New("this link is invalid, was already used or has expired")
+
+// deriveKey makes a key for one purpose out of the app's secret, so nothing
+// signed for one purpose checks out for another.
+func deriveKey(secret []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// linkToken signs a token for an emailed link. It names the purpose, the
+// user, when it expires and the state of the account it was made for.
+func (app *App) linkToken(purpose string, user *models.User, lifetime time.Duration) string {
+	payload := strings.Join([]string{
+		purpose,
+		strconv.Itoa(user.ID),
+		strconv.FormatInt(time.Now().Add(lifetime).Unix(), 10),
+		accountStamp(purpose, user),
+	}, ".")
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + app.signLink(payload)
+}
+
+func (app *App) signLink(payload string) string {
+	mac := hmac.New(sha256.New, app.linkKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// checkLinkToken returns the user a token for purpose was made for, or
+// errBadLink unless the token is genuine, unexpired and the account is still
+// in the state it was made for.
+func (app *App) checkLinkToken(token, purpose string) (*models.User, error) {
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, errBadLink
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errBadLink
+	}
+	payload := string(raw)
+	if !hmac.Equal([]byte(signature), []byte(app.signLink(payload))) {
+		return nil, errBadLink
+	}
+
+	fields := strings.Split(payload, ".")
+	if len(fields) != 4 || fields[0] != purpose {
+		return nil, errBadLink
+	}
+	userID, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, errBadLink
+	}
+	expires, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, errBadLink
+	}
+	user, err := models.GetUserByID(userID)
+	if err != nil || !hmac.Equal([]byte(fields[3]), []byte(accountStamp(purpose, user))) {
+		return nil, errBadLink
+	}
+	return user, nil
+}
+
+// accountStamp sums up the part of an account a link changes, which makes
+// links single-use: a new password hash ends every reset link made before
+// it, and verifying an address, or changing it, ends the verification links.
+func accountStamp(purpose string, user *models.User) string {
+	state := purpose + "\x00"
+	switch purpose {
+	case linkResetPassword:
+		state += user.Password
+	case linkVerifyEmail:
+		state += user.Email + "\x00" + strconv.FormatBool(user.EmailVerified)
+	}
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// link returns the full address of path on the forum with a token.
+func (app *App) link(path, token string) string {
+	return strings.TrimSuffix(app.Config.BaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// verificationEmail is the email with the link that verifies a user's
+// address.
+func (app *App) verificationEmail(user *models.User) Message {
+	link := app.link("/verify-email", app.linkToken(linkVerifyEmail, user, verifyLinkLifetime))
+	return Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Open this link to verify your email address on the forum:\n\n" + link + "\n\n" +
+			"The link works for 7 days. If you didn't register, you can ignore this email.\n",
+	}
+}
+
+// requestPasswordReset emails a reset link to the account using email, if
+// there is one. The email goes out in the background and failures are only
+// logged, so neither the answer nor how long it takes tells whether an
+// address is registered.
+func (app *App) requestPasswordReset(email string) {
+	user, err := models.GetUserByEmail(strings.TrimSpace(email))
+	if err != nil {
+		return
+	}
+	link := app.link("/reset-password", app.linkToken(linkResetPassword, user, resetLinkLifetime))
+	app.sendInBackground(Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Someone asked to reset the password of your forum account. Open this link to choose a new one:\n\n" + link + "\n\n" +
+			"The link works once, for an hour. If you didn't ask for it, ignore this email; your password stays the same.\n",
+	}, "password reset")
+}
+
+// sendInBackground sends msg without making the request wait for the mail
+// server. Failures are logged; what names the email in the log.
+func (app *App) sendInBackground(msg Message, what string) {
+	app.mailing.Add(1)
+	go func() {
+		defer app.mailing.Done()
+		if err := app.Mailer.Send(msg); err != nil {
+			log.Printf("Error sending %s email: %v", what, err)
+		}
+	}()
+}
+
+// WaitForMail waits until the emails still being sent in the background are
+// out, or ctx ends. It is called once while the server shuts down.
+func (app *App) WaitForMail(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		app.mailing.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resetPassword sets a new password for the user a reset token was made
+// for, revokes their personal access tokens and ends all of their sessions,
+// so whoever else had the account loses it. A bad token gives errBadLink, a
+// bad password a models.ValidationError.
+func (app *App) resetPassword(token, password string) error {
+	user, err := app.checkLinkToken(token, linkResetPassword)
+	if err != nil {
+		return err
+	}
+	if err := models.ValidatePassword(password); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), app.Config.BcryptCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := models.SetPassword(user.ID, string(hash)); err != nil {
+		return err
+	}
+	if err := models.DeleteUserAPITokens(user.ID); err != nil {
+		return err
+	}
+	return app.Sessions.DeleteAll(user.ID)
+}
+
+// verifyEmail marks the address a verification token was made for as
+// verified.
+func (app *App) verifyEmail(token string) error {
+	user, err := app.checkLinkToken(token, linkVerifyEmail)
+	if err != nil {
+		return err
+	}
+	return models.VerifyEmail(user.ID, user.Email)
+}
+
+// --- Pages ---
+
+// ForgotPasswordHandler asks for an email address and sends a reset link to
+// it. The answer is the same whether or not the address is registered.
+func (app *App) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.RenderTemplate(w, r, "forgotPassword", nil)
+	case http.MethodPost:
+		app.requestPasswordReset(r.FormValue("email"))
+		app.RenderTemplate(w, r, "forgotPassword", map[string]interface{}{"Sent": true})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+	}
+}
+
+// ResetPasswordHandler shows the new password form of a reset link and sets
+// the password. Afterwards the user logs in again everywhere.
+func (app *App) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		token := r.URL.Query().Get("token")
+		if _, err := app.checkLinkToken(token, linkResetPassword); err != nil {
+			w.WriteHeader(http.StatusBadRequest) // 400
+			app.RenderTemplate(w, r, "resetPassword", map[string]interface{}{"BadLink": errBadLink.Error()})
+			return
+		}
+		app.RenderTemplate(w, r, "resetPassword", map[string]interface{}{"Token": token})
+
+	case http.MethodPost:
+		token := r.FormValue("token")
+		err := app.resetPassword(token, r.FormValue("password"))
+		if errs := fieldErrors(err); errs != nil {
+			w.WriteHeader(http.StatusBadRequest) // 400
+			app.RenderTemplate(w, r, "resetPassword", map[string]interface{}{"Token": token, "Errors": errs})
+			return
+		}
+		if errors.Is(err, errBadLink) {
+			w.WriteHeader(http.StatusBadRequest) // 400
+			app.RenderTemplate(w, r, "resetPassword", map[string]interface{}{"BadLink": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Println("Error resetting password:", err)
+			w.WriteHeader(http.StatusInternalServerError) // 500
+			app.RenderTemplate(w, r, "500", nil)
+			return
+		}
+		app.RenderTemplate(w, r, "login", map[string]interface{}{"Notice": "Your password was changed. Log in with the new one."})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+	}
+}
+
+// VerifyEmailHandler is where verification links lead.
+func (app *App) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	pageData := map[string]interface{}{"Title": "Email verified", "Message": "Thanks, your email address is verified."}
+	err := app.verifyEmail(r.URL.Query().Get("token"))
+	if errors.Is(err, errBadLink) {
+		w.WriteHeader(http.StatusBadRequest) // 400
+		pageData["Title"] = "Email not verified"
+		pageData["Message"] = "Sorry, " + err.Error() + ". The Account page can send a new one."
+	} else if err != nil {
+		log.Println("Error verifying email:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	app.RenderTemplate(w, r, "message", pageData)
+}
+
+// ResendVerificationHandler emails the logged in user a new verification
+// link in the background.
+func (app *App) ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	if !user.EmailVerified {
+		app.sendInBackground(app.verificationEmail(user), "verification")
+	}
+	app.renderAccount(w, r, map[string]interface{}{"VerificationSent": !user.EmailVerified})
+}
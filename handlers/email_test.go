@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"Forum/config"
+	"Forum/models"
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// captureMailer keeps the emails it is asked to send.
+type captureMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (m *captureMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// lastToken returns the token of the link in the last email sent.
+func (m *captureMailer) lastToken(t *testing.T, app *App) string {
+	t.Helper()
+	app.WaitForMail(context.Background())
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0 {
+		t.Fatal("no email sent")
+	}
+	body := m.sent[len(m.sent)-1].Body
+	start := strings.Index(body, "http")
+	if start < 0 {
+		t.Fatalf("no link in %q", body)
+	}
+	link, err := url.Parse(strings.Fields(body[start:])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Query().Get("token")
+}
+
+// newEmailTestApp returns an App on a fresh database with one registered
+// user, alice, whose verification email is in the mailer.
+func newEmailTestApp(t *testing.T) (*App, *captureMailer, *models.User) {
+	t.Helper()
+	models.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	t.Cleanup(func() { models.CloseDB() })
+
+	mailer := &captureMailer{}
+	app := &App{
+		Config:   &config.Config{BcryptCost: bcrypt.MinCost, BaseURL: "http://forum.test/"},
+		Sessions: NewMemorySessionStore(),
+		Mailer:   mailer,
+		linkKey:  deriveKey([]byte("secret"), "email links"),
+	}
+	user, err := app.registerUser("alice@example.com", "alice", "password1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return app, mailer, user
+}
+
+func TestVerifyEmailLink(t *testing.T) {
+	app, mailer, user := newEmailTestApp(t)
+	if user.EmailVerified {
+		t.Fatal("new user already verified")
+	}
+	token := mailer.lastToken(t, app)
+
+	if err := app.verifyEmail(token); err != nil {
+		t.Fatal(err)
+	}
+	if user, _ = models.GetUserByID(user.ID); !user.EmailVerified {
+		t.Error("email not verified")
+	}
+	if err := app.verifyEmail(token); !errors.Is(err, errBadLink) {
+		t.Errorf("second use: got %v, want errBadLink", err)
+	}
+}
+
+func TestResetPasswordLink(t *testing.T) {
+	app, mailer, user := newEmailTestApp(t)
+	session := models.Session{ID: "session", UserID: user.ID, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	if err := app.Sessions.Create(session); err != nil {
+		t.Fatal(err)
+	}
+	_, apiToken, err := models.CreateAPIToken(user.ID, "bot", models.ScopePost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.requestPasswordReset("nobody@example.com")
+	app.WaitForMail(context.Background())
+	if len(mailer.sent) != 1 {
+		t.Fatalf("%d emails sent for an unknown address", len(mailer.sent)-1)
+	}
+	app.requestPasswordReset(" alice@example.com ")
+	token := mailer.lastToken(t, app)
+
+	if _, err := app.checkLinkToken(token, linkVerifyEmail); !errors.Is(err, errBadLink) {
+		t.Errorf("reset token used for verification: got %v, want errBadLink", err)
+	}
+	var invalid models.ValidationError
+	if err := app.resetPassword(token, "short"); !errors.As(err, &invalid) {
+		t.Errorf("short password: got %v, want a ValidationError", err)
+	}
+	if err := app.resetPassword(token, "new password"); err != nil {
+		t.Fatal(err)
+	}
+
+	user, _ = models.GetUserByID(user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("new password")) != nil {
+		t.Error("password not changed")
+	}
+	if _, ok := app.Sessions.Get(session.ID); ok {
+		t.Error("session survived the reset")
+	}
+	if _, err := models.GetAPIToken(apiToken); !errors.Is(err, models.ErrTokenNotFound) {
+		t.Errorf("personal access token after the reset: got %v, want ErrTokenNotFound", err)
+	}
+	if err := app.resetPassword(token, "another password"); !errors.Is(err, errBadLink) {
+		t.Errorf("second use: got %v, want errBadLink", err)
+	}
+}
+
+func TestCheckLinkTokenRefusesBadTokens(t *testing.T) {
+	app, _, user := newEmailTestApp(t)
+	token := app.linkToken(linkResetPassword, user, time.Hour)
+	if _, err := app.checkLinkToken(token, linkResetPassword); err != nil {
+		t.Fatalf("good token refused: %v", err)
+	}
+
+	other := &App{linkKey: deriveKey([]byte("other secret"), "email links")}
+	bad := map[string]string{
+		"empty":        "",
+		"no signature": strings.Split(token, ".")[0],
+		"tampered":     "x" + token,
+		"expired":      app.linkToken(linkResetPassword, user, -time.Second),
+		"other key":    other.linkToken(linkResetPassword, user, time.Hour),
+	}
+	for name, token := range bad {
+		if _, err := app.checkLinkToken(token, linkResetPassword); !errors.Is(err, errBadLink) {
+			t.Errorf("%s: got %v, want errBadLink", name, err)
+		}
+	}
+}
+
+func TestFormatMessageRefusesHeaderInjection(t *testing.T) {
+	msg := Message{To: "alice@example.com\r\nBcc: eve@example.com", Subject: "Hi", Body: "Hello"}
+	if _, err := formatMessage("forum@example.com", msg, time.Now()); !errors.Is(err, errMailHeader) {
+		t.Errorf("got %v, want errMailHeader", err)
+	}
+}
+
+func TestSMTPMailerGivesUpOnAHungServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		// Accept and never say anything
+		conn, err := l.Accept()
+		if err == nil {
+			<-done
+			conn.Close()
+		}
+	}()
+
+	m := NewSMTPMailer(l.Addr().String(), "forum@example.com", "", "")
+	m.timeout = 100 * time.Millisecond
+	start := time.Now()
+	if err := m.Send(Message{To: "alice@example.com", Subject: "Hi", Body: "Hello"}); err == nil {
+		t.Fatal("sent through a server that never answered")
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Errorf("gave up after %s", waited)
+	}
+}
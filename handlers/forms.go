@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+)
+
+// fieldErrors returns the message per form field of a
+// models.ValidationError, and nil for any other error. Forms show the
+// messages next to their fields as .Errors.<field>.
+func fieldErrors(err error) map[string]string {
+	var invalid models.ValidationError
+	if errors.As(err, &invalid) {
+		return invalid
+	}
+	return nil
+}
@@ -2,85 +2,50 @@ package handlers
 
 import (
 	"Forum/models"
+	"errors"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
-
-	"os"
-	"path/filepath"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
-var templates = template.Must(template.ParseGlob("templates/*.html"))
-
-// renderTemplate helper function
-func RenderTemplate(w http.ResponseWriter, tmpl string, data interface{}) {
-	tmplPath := filepath.Join("templates", tmpl+".html")
-
-	// Check if the requested template file exists
-	if _, err := os.Stat(tmplPath); os.IsNotExist(err) {
-		// Template not found, check if the 404 page exists
-		if _, err404 := os.Stat(filepath.Join("templates", "404.html")); os.IsNotExist(err404) {
-			// 404.html is missing, directly return 404 error
-			http.Error(w, "404 page not found", http.StatusNotFound)
-			return
-		}
-
-		// Render the 404 error page if the requested template is missing and 404 page exists
-		err404 := templates.ExecuteTemplate(w, "404.html", nil)
-		if err404 != nil {
-			// If rendering 404 template fails, fallback to default 404 message
-			http.Error(w, "404 page not found", http.StatusNotFound)
-		}
-		return
-	}
-
-	// Attempt to execute the requested template
-	err := templates.ExecuteTemplate(w, tmpl+".html", data)
-	if err != nil {
-		log.Print(err)
-
-		// Render the 500 error page if there's an internal server error
-		err500 := templates.ExecuteTemplate(w, "500.html", nil)
-		if err500 != nil {
-			// If rendering 500 template fails, fallback to default 500 message
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-		}
-	}
-}
-
-
 // BaseHandler serves pages with the base layout (base.html)
-func HomeHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" &&  r.URL.Path != "/home" {
 		w.WriteHeader(http.StatusNotFound) // Set the 404 status code
-		RenderTemplate(w, "404", nil)      // Render custom 404 page
+		app.RenderTemplate(w, r, "404", nil)      // Render custom 404 page
 		return
 	}
 	if r.Method == http.MethodGet {
 		
 	
 	
-	userID, isLoggedIn := GetUserIDFromSession(r)
+	user := currentUser(r)
+	isLoggedIn := user != nil
 	// templateName = "base"
 	pageData := make(map[string]interface{})
 	// Common data across all templates using base.html
 	pageData["IsLoggedIn"] = isLoggedIn
-	pageData["UserID"] = userID
+	if isLoggedIn {
+		pageData["UserID"] = user.Username
+	}
 
 	Catagories, err := models.GetAllCategories()
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound) // Set the 404 status code
-		RenderTemplate(w, "404", nil)      // Render custom 404 page
+		app.RenderTemplate(w, r, "404", nil)      // Render custom 404 page
 		return
 	}
 	var CatagoryDetails []map[string]interface{}
 	for _, Catagory := range Catagories {
 		CatagoryDetail := map[string]interface{}{
+			"ID":       Catagory.ID,
 			"Catagory": Catagory.Name,
 		}
 		CatagoryDetails = append(CatagoryDetails, CatagoryDetail)
@@ -90,12 +55,11 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 
 
 
-	posts, err := models.GetAllPosts()
-	if err != nil {
-		http.Error(w, "Unable to load posts", http.StatusInternalServerError)
-		RenderTemplate(w, "500", nil)   // 500
+	page := app.listPosts(w, r, models.PostQuery{})
+	if page == nil {
 		return
 	}
+	posts := page.Posts
 	isExist := true
 	if posts == nil {
 		isExist = false
@@ -120,13 +84,14 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 		pageData["NoPosts"] = "No Liked posts found."
 	}
 	pageData["Posts"] = postDetails
+	addPagination(pageData, r, page)
 
 
 	
 
 	// Render the template with base.html as the layout
 	if pageData == nil {
-		templates, err := template.ParseFiles("templates/500.html")
+		templates, err := template.ParseFiles(filepath.Join(app.Config.TemplateDir, "500.html"))
 		if err != nil {
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			log.Println("Error loading 500 template:", err)
@@ -136,98 +101,67 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 		templates.Execute(w, nil)
 		return
 	}
-	RenderTemplate(w, "base", pageData)
+	app.RenderTemplate(w, r, "base", pageData)
 	// ExecuteTemplate
 }
 }
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
 		
-		RenderTemplate(w, "register", nil)
+		app.RenderTemplate(w, r, "register", nil)
 	} 
 	if r.Method == http.MethodPost {
 		// Extract form data
 		email := r.FormValue("email")
 		username := r.FormValue("username")
 		password := r.FormValue("password")
-		// Validate inputs
-		if email == "" || username == "" || password == "" {
-
-			t, err := template.ParseFiles("templates/500.html")
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			log.Println("Error loading 500 template:", err)
-			return
-		}
-		w.WriteHeader(http.StatusInternalServerError)
-		t.Execute(w, nil)
-		return
-		
-		}
-		// Hash the password
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-		if err != nil {
-			log.Println("Error hashing password:", err)
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
-		// Create a new user object
-		newUser := models.User{
-			Email:    email,
-			Username: username,
-			Password: string(hashedPassword),
-		}
-		// Save the user to the database
-		err = models.CreateUser(newUser)
+		// Save the user to the database; registerUser validates the input
+		user, err := app.registerUser(email, username, password)
 		if err != nil {
+			// Show the form again with what the user typed, except the password
+			pageData := map[string]interface{}{
+				"Email":    email,
+				"Username": username,
+			}
+			if errs := fieldErrors(err); errs != nil {
+				pageData["Errors"] = errs
+				w.WriteHeader(http.StatusBadRequest) // 400
+				app.RenderTemplate(w, r, "register", pageData)
+				return
+			}
 			if err == models.ErrUserExists {
-				pageData := map[string]interface{}{
-					"InvalidRegister": "Email or username already exists",
-				}
-				RenderTemplate(w, "register", pageData)
+				pageData["InvalidRegister"] = "Email or username already exists"
+				app.RenderTemplate(w, r, "register", pageData)
 				return
-			} else {
-				log.Println("Error creating user:", err)
-				http.Error(w, "Internal server error", http.StatusInternalServerError)
 			}
-			return
-		}
-		user, err := models.GetUserByEmail(email)
-		if err != nil {
-			http.Error(w, "Invalid login", http.StatusUnauthorized)
+			log.Println("Error creating user:", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
 		// Redirect to the login page or home page
-		CreateSession(w, user.Username)
+		app.CreateSession(w, r, user.ID)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 
 	}
 }
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		RenderTemplate(w, "login", nil)
+		app.RenderTemplate(w, r, "login", nil)
 		return
 	} 
 	
 	if r.Method == http.MethodPost {
 		Email_UserName := r.FormValue("email")
 		password := r.FormValue("password")
-		user, err := models.GetUserByEmail(Email_UserName)
+		user, wait, err := app.checkLogin(r, Email_UserName, password)
 		if err != nil {
-			user, err = models.GetUserByUserName(Email_UserName)
-		}
-		
-		if err != nil || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
-			pageData := map[string]interface{}{
-				"InvalidLogin": "The Username or Password is Uncorrect",
-			}
-			RenderTemplate(w, "login", pageData)
+			app.loginError(w, r, wait, err)
 			return
 		}
 
-		CreateSession(w, user.Username)
+		app.CreateSession(w, r, user.ID)
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
@@ -235,80 +169,130 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 //-----------------------------------------------------------------------
 
 
-func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
-	
-	userID, loggedIn := GetUserIDFromSession(r)
-	if !loggedIn {
-		http.Redirect(w, r, "/login", http.StatusSeeOther) // 303
-		return
+// registerUser checks the input, hashes the password and stores a new user.
+// Spaces around the email and username are dropped. Bad input comes back as a
+// models.ValidationError.
+func (app *App) registerUser(email, username, password string) (*models.User, error) {
+	email, username = strings.TrimSpace(email), strings.TrimSpace(username)
+	if err := models.ValidateUser(email, username, password); err != nil {
+		return nil, err
 	}
-	if err := r.ParseForm(); err != nil {
-		fmt.Fprintf(w, "ParseForm() err: %v", err)
-		return
+	// Hash the password
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), app.Config.BcryptCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	// Create a new user object
+	newUser := models.User{
+		Email:    email,
+		Username: username,
+		Password: string(hashedPassword),
+	}
+	if err := models.CreateUser(newUser); err != nil {
+		return nil, err
+	}
+	user, err := models.GetUserByEmail(email)
+	if err != nil {
+		return nil, err
 	}
+	// The account works without a verified address, so registering doesn't
+	// wait for the mail server; the account page can send another email.
+	app.sendInBackground(app.verificationEmail(user), "verification")
+	return user, nil
+}
 
-	if r.Method == http.MethodGet {
-		
-		Catagories, _ := models.GetAllCategories()
-		pageData := make(map[string]interface{})
-		var postDetails []map[string]interface{}
-	for _, Catagory := range Catagories {
-		postDetail := map[string]interface{}{
-			"Catagory": Catagory.Name,
+// checkLogin looks the user up by email or username and checks the password.
+// Failed logins are counted; once there are too many for the account or the
+// client's IP address, it returns models.ErrAccountLocked or
+// models.ErrLoginThrottled and how long to wait, without checking the
+// password.
+func (app *App) checkLogin(r *http.Request, emailOrUsername, password string) (*models.User, time.Duration, error) {
+	user, err := models.GetUserByEmail(emailOrUsername)
+	if err != nil {
+		user, err = models.GetUserByUserName(emailOrUsername)
+	}
+	userID, hash := 0, app.dummyHash
+	if err == nil {
+		userID, hash = user.ID, []byte(user.Password)
+	}
+	ip := app.clientIP(r)
+	limits := models.LoginLimits{
+		MaxFailures:   app.Config.LoginMaxFailures,
+		IPMaxFailures: app.Config.LoginIPMaxFailures,
+		Lockout:       app.Config.LoginLockout,
+	}
+	attempt, wait, err := models.BeginLogin(userID, ip, limits)
+	if err != nil {
+		return nil, wait, err
+	}
+
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || userID == 0 {
+		locked, err := models.RecordLoginFailure(userID, limits)
+		if err != nil {
+			return nil, 0, err
 		}
-		postDetails = append(postDetails, postDetail)
+		if locked {
+			log.Printf("Locked account %d after %d failed logins", userID, limits.MaxFailures)
+		}
+		return nil, 0, errInvalidLogin
 	}
-		pageData["Catagories"] = postDetails
-		RenderTemplate(w, "createPost", pageData)
-		
-		return
+	if err := models.RecordLoginSuccess(user.ID, attempt); err != nil {
+		return nil, 0, err
 	}
-	 if r.Method == http.MethodPost {
-		title := r.FormValue("title")
-		content := r.FormValue("content")
-		categories := r.Form["categories[]"]
-		stringCategories := strings.Join(categories, ",")
-		
+	return user, 0, nil
+}
 
+//-----------------------------------------------------------------------
 
-	
 
-		// Check if title and content are provided
-		if title == "" || content == "" || len(categories) == 0 {
+func (app *App) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
 
-			http.Error(w, "Bad request: Missing PostID or Comment", http.StatusBadRequest) 
+	switch r.Method {
+	case http.MethodGet:
+		app.renderPostForm(w, r, 0, "", "", nil, nil)
 
+	case http.MethodPost:
+		title := r.FormValue("title")
+		content := r.FormValue("content")
+		categoryIDs, err := parseCategoryIDs(r)
+		if err != nil {
+			http.Error(w, "Bad request: Invalid category", http.StatusBadRequest) // 400
+			return
 		}
 
-		// Attempt to create the post
-		err := models.CreatePost(userID, title, content, stringCategories)
+		// Attempt to create the post; bad input goes back to the form
+		_, err = models.CreatePost(user.ID, title, content, categoryIDs)
+		if errs := fieldErrors(err); errs != nil {
+			app.renderPostForm(w, r, 0, title, content, categoryIDs, errs)
+			return
+		}
 		if err != nil {
-			http.Error(w, err.Error() , http.StatusInternalServerError) // 500
+			log.Println("Error creating post:", err)
+			w.WriteHeader(http.StatusInternalServerError) // 500
+			app.RenderTemplate(w, r, "500", nil)
 			return
 		}
 
 		http.Redirect(w, r, "/", http.StatusSeeOther) // 303
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
 	}
 }
 
 //-----------------------------------------------------------------------
 
 
-func CreatedPostsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, isLoggedIn := GetUserIDFromSession(r)
-
-	// Check if user is logged in
-	if !isLoggedIn {
-		http.Redirect(w, r, "/", http.StatusSeeOther) // 303
-		return
-	}
+func (app *App) CreatedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
 
 	// Get posts for the logged-in user
-	posts, err := models.GetPostsFromUserID(userID)
-	if err != nil {
-		http.Error(w, "Unable to load posts", http.StatusInternalServerError) // 500
+	page := app.listPosts(w, r, models.PostQuery{AuthorID: user.ID})
+	if page == nil {
 		return
 	}
+	posts := page.Posts
 	isExist := true
 	if posts == nil {
 		isExist = false
@@ -327,31 +311,26 @@ func CreatedPostsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	pageData := make(map[string]interface{})
 	pageData["isExist"] = isExist
-	pageData["IsLoggedIn"] = isLoggedIn
+	pageData["IsLoggedIn"] = true
 	pageData["Title"] = "My Created"
 	if isExist == false {
 		pageData["NoPosts"] = "No created posts found."
 	}
 	pageData["Posts"] = postDetails
-	RenderTemplate(w, "ListsViewer", pageData)
+	addPagination(pageData, r, page)
+	app.RenderTemplate(w, r, "ListsViewer", pageData)
 	
 }
 
-func LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
-	userID, isLoggedIn := GetUserIDFromSession(r)
-
-	// Check if user is logged in
-	if !isLoggedIn {
-		http.Redirect(w, r, "/", http.StatusSeeOther) // 303
-		return
-	}
+func (app *App) LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
 
 	// Get posts for the logged-in user
-	posts, err := models.GetPostsFromLiked(userID)
-	if err != nil {
-		http.Error(w, "Unable to load posts", http.StatusInternalServerError) // 500
+	page := app.listPosts(w, r, models.PostQuery{LikedBy: user.ID})
+	if page == nil {
 		return
 	}
+	posts := page.Posts
 	isExist := true
 	if posts == nil {
 		isExist = false
@@ -370,96 +349,110 @@ func LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	pageData := make(map[string]interface{})
 	pageData["isExist"] = isExist
-	pageData["IsLoggedIn"] = isLoggedIn
+	pageData["IsLoggedIn"] = true
 	pageData["Title"] = "Liked"
 	if isExist == false {
 		pageData["NoPosts"] = "No Liked posts found."
 	}
 	pageData["Posts"] = postDetails
-	RenderTemplate(w, "ListsViewer", pageData)
+	addPagination(pageData, r, page)
+	app.RenderTemplate(w, r, "ListsViewer", pageData)
 	
 }
 
-func ViewPostHandler(w http.ResponseWriter, r *http.Request) {
-	_, isLoggedIn := GetUserIDFromSession(r)
+func (app *App) ViewPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	isLoggedIn := user != nil
 	isExist := true
 	id := r.URL.Query().Get("id")
 
 	// Retrieve post by ID
 	post, err0 := models.GetPostByID(id)
-	comments, err := models.GetCommentsByPostID(id)
-	if err0 != nil {
+	comments, err := models.GetCommentTree(id, app.Config.MaxCommentDepth)
+	if err0 != nil || (post.Hidden && !isModerator(r)) {
 		w.WriteHeader(http.StatusNotFound) // 404
-		RenderTemplate(w, "404", nil)      // Render custom 404 page if post not found
+		app.RenderTemplate(w, r, "404", nil)      // Render custom 404 page if post not found
 		return
 	}
 
 	// Check for errors in retrieving comments
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError) // 500
-		RenderTemplate(w, "500", nil)                 // Render custom 500 page for internal error
+		app.RenderTemplate(w, r, "500", nil)                 // Render custom 500 page for internal error
 		return
 	}
 
 
-	// Populate comments for the template
-	var CommentDetails []map[string]interface{}
-	for _, comment := range comments {
-		
-		CommentlikeCount , _ := models.CommentLikeCounter(strconv.Itoa(comment.ID))
-		CommentDislikeCount , _ := models.CommentDisLikeCounter(strconv.Itoa(comment.ID))
-		
-		commentDetail := map[string]interface{}{
-			"PostID" :		id,
-			"id":			 comment.ID,
-			"Author":        comment.Author,
-			"comment":       comment.Content,
-			"created_at":    comment.Created_at,
-			"CommentUserID": comment.User_ID,
-			"IsLoggedIn": 	isLoggedIn,
-			"likes" : 		CommentlikeCount,
-			"DisLikes" : 	CommentDislikeCount,
-
-		}
-		CommentDetails = append(CommentDetails, commentDetail)
+	// Count the reactions of the post and all its comments at once
+	reactions, commentReactions, err := models.GetPostReactions(id, viewerID(r))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
 	}
-	likeCount , _ := models.LikeCounter(id)
-	DislikeCount , _ := models.DisLikeCounter(id)	
+
+	// Populate comments for the template
+	CommentDetails := app.commentDetails(r, id, post.Locked, comments, commentReactions)
 	// Prepare page data with post details and comments
 	pageData := make(map[string]interface{})
 	pageData["id"] = id
 	pageData["Author"] = post.Author
 	pageData["Title"] = post.Title
 	pageData["Content"] = post.Content
+	pageData["Categories"] = post.Category
+	pageData["UpdatedAt"] = post.Updated_at
+	pageData["IsAuthor"] = isLoggedIn && user.ID == post.UserID
 	pageData["IsLoggedIn"] = isLoggedIn
 	pageData["isExist"] = isExist
 	pageData["Comments"] = CommentDetails
-	pageData["likes"] = likeCount
-	pageData["DisLikes"] = DislikeCount
+	pageData["Reactions"] = app.reactionButtons(reactions)
+	pageData["Hidden"] = post.Hidden
+	pageData["Locked"] = post.Locked
+	if isModerator(r) {
+		// The move form lists every category with the current ones ticked
+		checked := make(map[int]bool)
+		for _, category := range post.Category {
+			checked[category.ID] = true
+		}
+		Catagories, _ := models.GetAllCategories()
+		var categoryDetails []map[string]interface{}
+		for _, Catagory := range Catagories {
+			categoryDetails = append(categoryDetails, map[string]interface{}{
+				"ID":       Catagory.ID,
+				"Catagory": Catagory.Name,
+				"Checked":  checked[Catagory.ID],
+			})
+		}
+		pageData["Catagories"] = categoryDetails
+	}
 
 	// Render the view post template
-	RenderTemplate(w, "viewPost", pageData)
+	app.RenderTemplate(w, r, "viewPost", pageData)
 	
 }
-func CatagoryHandler(w http.ResponseWriter, r *http.Request) {
-	_, isLoggedIn := GetUserIDFromSession(r)
-	catagory := r.FormValue("Catagory")
+func (app *App) CatagoryHandler(w http.ResponseWriter, r *http.Request) {
+	isLoggedIn := currentUser(r) != nil
 	isExist := true
 
-	// Retrieve all posts in the category
-	posts, err := models.GetAllCategoryPosts(catagory)
+	categoryID, err := strconv.Atoi(r.FormValue("id"))
 	if err != nil {
-		
 		w.WriteHeader(http.StatusNotFound) // 404
-		RenderTemplate(w, "404", nil)      // Render custom 404 page for category not found
+		app.RenderTemplate(w, r, "404", nil)      // Render custom 404 page for category not found
 		return
 	}
-
+	catagory, err := models.GetCategoryByID(categoryID)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError) // 500
-		RenderTemplate(w, "500", nil)                 // Render custom 500 page for internal error
+		w.WriteHeader(http.StatusNotFound) // 404
+		app.RenderTemplate(w, r, "404", nil)      // Render custom 404 page for category not found
+		return
+	}
+
+	// Retrieve a page of posts in the category
+	page := app.listPosts(w, r, models.PostQuery{CategoryID: catagory.ID})
+	if page == nil {
 		return
 	}
+	posts := page.Posts
 
 	pageData := make(map[string]interface{})
 
@@ -484,53 +477,43 @@ func CatagoryHandler(w http.ResponseWriter, r *http.Request) {
 	// Populate page data with the relevant info
 	pageData["IsLoggedIn"] = isLoggedIn
 	pageData["Posts"] = postDetails
+	addPagination(pageData, r, page)
 	pageData["isExist"] = isExist
-	pageData["Title"] = catagory
+	pageData["Title"] = catagory.Name
 	if isExist == false {
 		pageData["NoPosts"] = "This Catagory is Empty."
 	}
 
 	// Render the category view template
-	RenderTemplate(w, "ListsViewer", pageData)
+	app.RenderTemplate(w, r, "ListsViewer", pageData)
 	
 }
 
 //-----------------------------------------------------------------------
-// Set a flag for cooldown period
 
-
-
-func LikeHandler(w http.ResponseWriter, r *http.Request) {
-	userID, _ := GetUserIDFromSession(r)
-	postID := r.URL.Query().Get("post_id")
-	like := r.URL.Query().Get("like") // "1" for like, "0" for dislike
-
-	// Logic to update the like/dislike in the database
-	if postID == "" || (like != "1" && like != "-1") {
-		http.Error(w, "Bad request: Missing PostID or Comment", http.StatusBadRequest) // 400 Bad Request
+func (app *App) LikeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
 		return
 	}
+	user := currentUser(r)
+	postID := r.FormValue("post_id")
+	reaction, ok := app.formReaction(r)
 
-	if like == "1" {
-		if models.IsLike(postID, userID) {
-			models.RemoveLike(postID, userID)
-			
-		} else if models.IsDisLike(postID, userID) {
-			models.UpdateLike(postID, userID, "1")
-
-		} else {
-			models.AddLike(postID, userID, "1")
-		}
-	} else if like == "-1" {
-		if models.IsDisLike(postID, userID) {
-			models.RemoveLike(postID, userID)
-
-		} else if models.IsLike(postID, userID) {
-			models.UpdateLike(postID, userID, "-1")
+	// Logic to update the reaction in the database
+	if postID == "" || !ok {
+		http.Error(w, "Bad request: Missing PostID or reaction", http.StatusBadRequest) // 400 Bad Request
+		return
+	}
 
-		} else {
-			models.AddLike(postID, userID, "-1")
-		}
+	id, err := strconv.Atoi(postID)
+	if err != nil {
+		http.Error(w, "Bad request: Invalid PostID", http.StatusBadRequest) // 400
+		return
+	}
+	if err := models.ToggleReaction(id, user.ID, reaction); err != nil {
+		app.reactionError(w, r, err)
+		return
 	}
 
 	http.Redirect(w, r, "/Post?id="+postID, http.StatusSeeOther)
@@ -538,38 +521,30 @@ func LikeHandler(w http.ResponseWriter, r *http.Request) {
 
 //-----------------------------------------------------------------------
 
-func LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
-	userID, _ := GetUserIDFromSession(r)
-	commentID := r.URL.Query().Get("Comment_id")
-	like := r.URL.Query().Get("like") // "1" for like, "0" for dislike
-	postID := r.URL.Query().Get("post_id")
-
-	// Logic to update the like/dislike in the database
-	if commentID == "" || (like != "1" && like != "-1") {
-		http.Error(w, "Bad request: Missing PostID or Comment", http.StatusBadRequest) // 400 Bad Request
+func (app *App) LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
 		return
 	}
+	user := currentUser(r)
+	commentID := r.FormValue("Comment_id")
+	reaction, ok := app.formReaction(r)
+	postID := r.FormValue("post_id")
 
-	if like == "1" {
-		if models.CommentIsLike(commentID, userID) {
-			models.CommentRemoveLike(commentID, userID)
-			
-		} else if models.CommentIsDisLike(commentID, userID) {
-			models.CommentUpdateLike(commentID, userID, "1")
-
-		} else {
-			models.CommentAddLike(commentID, userID, "1")
-		}
-	} else if like == "-1" {
-		if models.CommentIsDisLike(commentID, userID) {
-			models.CommentRemoveLike(commentID, userID)
-
-		} else if models.CommentIsLike(commentID, userID) {
-			models.CommentUpdateLike(commentID, userID, "-1")
+	// Logic to update the reaction in the database
+	if commentID == "" || !ok {
+		http.Error(w, "Bad request: Missing Comment_id or reaction", http.StatusBadRequest) // 400 Bad Request
+		return
+	}
 
-		} else {
-			models.CommentAddLike(commentID, userID, "-1")
-		}
+	id, err := strconv.Atoi(commentID)
+	if err != nil {
+		http.Error(w, "Bad request: Invalid Comment_id", http.StatusBadRequest) // 400
+		return
+	}
+	if err := models.ToggleCommentReaction(id, user.ID, reaction); err != nil {
+		app.reactionError(w, r, err)
+		return
 	}
 
 	http.Redirect(w, r, "/Post?id="+postID, http.StatusSeeOther)
@@ -579,9 +554,13 @@ func LikeCommentHandler(w http.ResponseWriter, r *http.Request) {
 
 //-----------------------------------------------------------------------
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
 	// Destroy the session
-	DestroySession(w, r)
+	app.DestroySession(w, r)
 	// Redirect to home page
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -589,24 +568,53 @@ func LogoutHandler(w http.ResponseWriter, r *http.Request) {
 //-----------------------------------------------------------------------
 
 
-func CommentHandler(w http.ResponseWriter, r *http.Request) {
-	userID, _ := GetUserIDFromSession(r)
+func (app *App) CommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+	user := currentUser(r)
 
 	// Extract form values
 	postId := r.FormValue("PostID")
 	comment := r.FormValue("PostComment")
+	parentID := 0 // a reply carries the comment it answers
+	if parent := r.FormValue("ParentID"); parent != "" {
+		var err error
+		if parentID, err = strconv.Atoi(parent); err != nil {
+			http.Error(w, "Bad request: Invalid ParentID", http.StatusBadRequest) // 400
+			return
+		}
+	}
 
 	// Check if required fields are present
-	if postId == "" || comment == "" {
-		http.Error(w, "Bad request: Missing PostID or Comment", http.StatusBadRequest) // 400
+	if postId == "" {
+		http.Error(w, "Bad request: Missing PostID", http.StatusBadRequest) // 400
 		return
 	}
 
 	// Attempt to create comment
-	err := models.CreateComment(userID, postId, comment)
+	_, err := models.CreateComment(user.ID, postId, comment, parentID)
+	if errs := fieldErrors(err); errs != nil {
+		http.Error(w, "Bad request: "+errs["comment"], http.StatusBadRequest) // 400
+		return
+	}
+	if errors.Is(err, models.ErrCommentNotFound) {
+		http.Error(w, "Bad request: The comment you replied to does not exist", http.StatusBadRequest) // 400
+		return
+	}
+	if errors.Is(err, models.ErrPostNotFound) {
+		w.WriteHeader(http.StatusNotFound) // 404
+		app.RenderTemplate(w, r, "404", nil)
+		return
+	}
+	if errors.Is(err, models.ErrPostLocked) {
+		http.Error(w, "Forbidden: This post is locked", http.StatusForbidden) // 403
+		return
+	}
 	if err != nil {
 		http.Error(w, "Internal server error 500", http.StatusInternalServerError) // 500
-		RenderTemplate(w, "500", nil)  
+		app.RenderTemplate(w, r, "500", nil)  
 		return
 	}
 
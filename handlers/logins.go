@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+var errInvalidLogin = errors.New("the username or password is incorrect")
+
+// loginError answers a failed login on the login page. Locked accounts and
+// blocked addresses get a 429 with a Retry-After header.
+func (app *App) loginError(w http.ResponseWriter, r *http.Request, wait time.Duration, err error) {
+	message := "The Username or Password is Uncorrect"
+	switch {
+	case errors.Is(err, errInvalidLogin):
+	case errors.Is(err, models.ErrAccountLocked), errors.Is(err, models.ErrLoginThrottled):
+		retryAfter(w, wait)
+		w.WriteHeader(http.StatusTooManyRequests) // 429
+		message = loginWaitMessage(wait, err)
+	default:
+		log.Println("Error checking login:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	app.RenderTemplate(w, r, "login", map[string]interface{}{"InvalidLogin": message})
+}
+
+// loginWaitMessage tells the user why and how long to wait before the next
+// login attempt.
+func loginWaitMessage(wait time.Duration, err error) string {
+	wait = wait.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if errors.Is(err, models.ErrAccountLocked) {
+		return "This account is locked after too many failed logins. Try again in " + wait.String() + " or ask an admin to unlock it."
+	}
+	return "Too many failed logins. Try again in " + wait.String() + "."
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"Forum/models"
+	"context"
+	"net/http"
+	"strings"
+)
+
+type userContextKey struct{}
+
+// tokenScopeContextKey holds the scope of the personal access token a
+// request authenticated with. Session-authenticated requests have none.
+type tokenScopeContextKey struct{}
+
+// LoadUser resolves the session cookie, or the bearer token of an API client,
+// to a models.User once per request and stores it in the request context,
+// where handlers read it with currentUser. A bearer token is either a
+// session ID or a personal access token, whose scope is stored as well. A
+// request carrying a bearer token is never authenticated by its cookie.
+// Requests without a valid session pass through with no user.
+func (app *App) LoadUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var userID int
+		var isLoggedIn bool
+		var scope string
+		if token, ok := bearerToken(r); ok {
+			if strings.HasPrefix(token, models.APITokenPrefix) {
+				if apiToken, err := models.GetAPIToken(token); err == nil {
+					userID, isLoggedIn, scope = apiToken.UserID, true, apiToken.Scope
+				}
+			} else {
+				userID, isLoggedIn = app.Sessions.Get(token)
+			}
+		} else {
+			userID, isLoggedIn = app.GetUserIDFromSession(r)
+		}
+		if isLoggedIn {
+			if user, err := models.GetUserByID(userID); err == nil {
+				ctx := context.WithValue(r.Context(), userContextKey{}, user)
+				if scope != "" {
+					ctx = context.WithValue(ctx, tokenScopeContextKey{}, scope)
+				}
+				r = r.WithContext(ctx)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAuth only lets requests from a logged in user through. Browsers are
+// sent to the login page; API clients get a 401.
+func (app *App) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if currentUser(r) == nil {
+			if wantsJSON(r) {
+				writeAPIError(w, http.StatusUnauthorized, "unauthorized", "Log in or send an Authorization: Bearer token") // 401
+				return
+			}
+			http.Redirect(w, r, "/login", http.StatusSeeOther) // 303
+			return
+		}
+		safe := r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions
+		if !safe && !hasScope(r, models.ScopePost) {
+			forbidToken(w, r, "This token is read-only")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// RequireSession is RequireAuth for pages that manage the account itself,
+// such as sessions and tokens. Personal access tokens can't use them, so a
+// leaked token can't be turned into a stronger one.
+func (app *App) RequireSession(next http.HandlerFunc) http.HandlerFunc {
+	return app.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if tokenScope(r) != "" {
+			forbidToken(w, r, "Personal access tokens can't manage the account")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// RequireModerator is RequireAuth for the moderator tools. The user must be a
+// moderator or an admin, and a personal access token needs the moderate
+// scope. The models check the role again inside their transaction.
+func (app *App) RequireModerator(next http.HandlerFunc) http.HandlerFunc {
+	return app.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		if !currentUser(r).IsModerator() {
+			if wantsJSON(r) {
+				writeAPIError(w, http.StatusForbidden, "forbidden", "Moderators only") // 403
+				return
+			}
+			http.Error(w, "Forbidden: moderators only", http.StatusForbidden) // 403
+			return
+		}
+		if !hasScope(r, models.ScopeModerate) {
+			forbidToken(w, r, "This token can't use the moderator tools")
+			return
+		}
+		next(w, r)
+	})
+}
+
+// RequireVerified keeps users who haven't verified their email address from
+// posting and commenting, when the forum is configured to. Wrap it in
+// RequireAuth.
+func (app *App) RequireVerified(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Config.RequireVerifiedEmail && !currentUser(r).EmailVerified {
+			if wantsJSON(r) {
+				writeAPIError(w, http.StatusForbidden, "email_unverified", "Verify your email address first") // 403
+				return
+			}
+			w.WriteHeader(http.StatusForbidden) // 403
+			app.RenderTemplate(w, r, "message", map[string]interface{}{
+				"Title":   "Verify your email",
+				"Message": "Verify your email address before posting. The Account page can send you a new link.",
+			})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// isModerator reports whether the request may use the moderator tools, and
+// so see what moderators hid.
+func isModerator(r *http.Request) bool {
+	user := currentUser(r)
+	return user != nil && user.IsModerator() && hasScope(r, models.ScopeModerate)
+}
+
+// tokenScope returns the scope of the personal access token the request
+// authenticated with, or "" for sessions.
+func tokenScope(r *http.Request) string {
+	scope, _ := r.Context().Value(tokenScopeContextKey{}).(string)
+	return scope
+}
+
+// hasScope reports whether the request may do what scope need allows.
+// Sessions may do anything their user may.
+func hasScope(r *http.Request, need string) bool {
+	scope := tokenScope(r)
+	return scope == "" || models.ScopeIncludes(scope, need)
+}
+
+func forbidToken(w http.ResponseWriter, r *http.Request, message string) {
+	if wantsJSON(r) {
+		writeAPIError(w, http.StatusForbidden, "insufficient_scope", message) // 403
+		return
+	}
+	http.Error(w, "Forbidden: "+message, http.StatusForbidden) // 403
+}
+
+// currentUser returns the user LoadUser found for this request, or nil.
+func currentUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey{}).(*models.User)
+	return user
+}
+
+// wantsJSON reports whether the client is a script rather than a browser.
+func wantsJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") ||
+		strings.Contains(r.Header.Get("Accept"), "application/json") ||
+		r.Header.Get("X-Requested-With") == "XMLHttpRequest"
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
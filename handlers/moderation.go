@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// modLogSize is how many audit log entries the dashboard shows.
+const modLogSize = 100
+
+// ModHandler shows the moderation dashboard: the audit log, the hidden posts,
+// the staff and the locked accounts. Admins also get the forms to change
+// roles and unlock accounts.
+func (app *App) ModHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	actions, err := models.GetModActions(modLogSize)
+	if err != nil {
+		log.Println("Error reading the audit log:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	hidden, err := models.ListPosts(models.PostQuery{Hidden: true, Limit: models.MaxPageSize})
+	if err != nil {
+		log.Println("Error listing hidden posts:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	staff, err := models.GetStaff()
+	if err != nil {
+		log.Println("Error listing staff:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	locked, err := models.GetLockedUsers()
+	if err != nil {
+		log.Println("Error listing locked accounts:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+	var lockedDetails []map[string]interface{}
+	for _, account := range locked {
+		lockedDetails = append(lockedDetails, map[string]interface{}{
+			"ID":          account.ID,
+			"Username":    account.Username,
+			"LockedUntil": account.LockedUntil.Local().Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	var actionDetails []map[string]interface{}
+	for _, action := range actions {
+		actor := action.Actor
+		if action.ActorID == 0 {
+			actor = "system"
+		}
+		actionDetails = append(actionDetails, map[string]interface{}{
+			"Actor":     actor,
+			"Action":    action.Action,
+			"Target":    action.Target,
+			"TargetID":  action.TargetID,
+			"IsPost":    action.Target == "post" && action.Action != models.ActionDeletePost,
+			"Reason":    action.Reason,
+			"Details":   action.Details,
+			"CreatedAt": action.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	pageData := make(map[string]interface{})
+	pageData["UserID"] = user.Username
+	pageData["Actions"] = actionDetails
+	pageData["HiddenPosts"] = hidden.Posts
+	pageData["Staff"] = staff
+	pageData["LockedUsers"] = lockedDetails
+	pageData["IsAdmin"] = user.IsAdmin()
+	pageData["Roles"] = models.Roles
+	app.RenderTemplate(w, r, "mod", pageData)
+}
+
+// ModPostHandler applies a moderator action to a post. The move action
+// takes the new categories from categories[] like the post form.
+func (app *App) ModPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid PostID", http.StatusBadRequest) // 400
+		return
+	}
+	action := r.FormValue("action")
+	reason := r.FormValue("reason")
+
+	if action == models.ActionMovePost {
+		categoryIDs, err := parseCategoryIDs(r)
+		if err != nil || len(categoryIDs) == 0 {
+			http.Error(w, "Bad request: Pick at least one category", http.StatusBadRequest) // 400
+			return
+		}
+		err = models.MovePost(user.ID, postID, categoryIDs, reason)
+	} else {
+		err = models.ModeratePost(user.ID, postID, action, reason)
+	}
+	if err != nil {
+		app.modError(w, r, err)
+		return
+	}
+
+	if action == models.ActionDeletePost {
+		http.Redirect(w, r, "/mod", http.StatusSeeOther) // 303
+		return
+	}
+	http.Redirect(w, r, "/Post?id="+strconv.Itoa(postID), http.StatusSeeOther) // 303
+}
+
+// ModCommentHandler applies a moderator action to a comment.
+func (app *App) ModCommentHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.FormValue("comment_id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid comment", http.StatusBadRequest) // 400
+		return
+	}
+	if err := models.ModerateComment(user.ID, commentID, r.FormValue("action"), r.FormValue("reason")); err != nil {
+		app.modError(w, r, err)
+		return
+	}
+	app.redirectToCommentPost(w, r, commentID)
+}
+
+// ModUserHandler changes the role of a user, picked by username. Only admins
+// may; SetUserRole checks.
+func (app *App) ModUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	target, err := models.GetUserByUserName(r.FormValue("username"))
+	if err != nil {
+		http.Error(w, "Bad request: No such user", http.StatusBadRequest) // 400
+		return
+	}
+	if err := models.SetUserRole(user.ID, target.ID, r.FormValue("role"), r.FormValue("reason")); err != nil {
+		app.modError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/mod", http.StatusSeeOther) // 303
+}
+
+// UnlockUserHandler lifts the lock failed logins put on an account. Only
+// admins may; UnlockUser checks.
+func (app *App) UnlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid user", http.StatusBadRequest) // 400
+		return
+	}
+	if err := models.UnlockUser(user.ID, userID, r.FormValue("reason")); err != nil {
+		app.modError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/mod", http.StatusSeeOther) // 303
+}
+
+// modError answers a failed moderator action.
+func (app *App) modError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid models.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		http.Error(w, "Bad request: "+invalid.Error(), http.StatusBadRequest) // 400
+	case errors.Is(err, models.ErrPostNotFound), errors.Is(err, models.ErrCommentNotFound), errors.Is(err, models.ErrUserNotFound),
+		errors.Is(err, models.ErrNoOpenReports):
+		w.WriteHeader(http.StatusNotFound) // 404
+		app.RenderTemplate(w, r, "404", nil)
+	case errors.Is(err, models.ErrNotModerator), errors.Is(err, models.ErrNotAdmin), errors.Is(err, models.ErrOwnRole):
+		http.Error(w, "Forbidden: "+err.Error(), http.StatusForbidden) // 403
+	case errors.Is(err, models.ErrInvalidAction), errors.Is(err, models.ErrInvalidRole), errors.Is(err, models.ErrReasonRequired):
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest) // 400
+	default:
+		log.Println("Error moderating:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// sortLabels names the sort modes in the listing pages.
+var sortLabels = map[string]string{
+	models.SortNewest:   "Newest",
+	models.SortOldest:   "Oldest",
+	models.SortTop:      "Top",
+	models.SortComments: "Most commented",
+	models.SortActive:   "Recently active",
+}
+
+// listPosts loads the page of posts picked by the sort, before, after and
+// limit query parameters, narrowed down by the filters already set in q.
+// On failure it answers the request itself and returns nil.
+func (app *App) listPosts(w http.ResponseWriter, r *http.Request, q models.PostQuery) *models.PostPage {
+	query := r.URL.Query()
+	q.Sort = query.Get("sort")
+	q.Before = query.Get("before")
+	q.After = query.Get("after")
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			http.Error(w, "Bad request: Invalid limit", http.StatusBadRequest) // 400
+			return nil
+		}
+		q.Limit = n
+	}
+
+	page, err := models.ListPosts(q)
+	if errors.Is(err, models.ErrInvalidSort) || errors.Is(err, models.ErrInvalidCursor) {
+		http.Error(w, "Bad request: "+err.Error(), http.StatusBadRequest) // 400
+		return nil
+	}
+	if err != nil {
+		log.Println("Error listing posts:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return nil
+	}
+	return page
+}
+
+// addPagination puts the sort links and the next/previous page links for
+// page into pageData. The links keep the other query parameters of r, such
+// as the category ID and the limit.
+func addPagination(pageData map[string]interface{}, r *http.Request, page *models.PostPage) {
+	current := r.URL.Query().Get("sort")
+	if current == "" {
+		current = models.SortNewest
+	}
+
+	var sorts []map[string]interface{}
+	for _, mode := range models.SortModes {
+		sorts = append(sorts, map[string]interface{}{
+			"Label":  sortLabels[mode],
+			"URL":    pageURL(r, "sort", mode),
+			"Active": mode == current,
+		})
+	}
+	pageData["Sorts"] = sorts
+
+	if page.Next != "" {
+		pageData["NextURL"] = pageURL(r, "before", page.Next)
+	}
+	if page.Prev != "" {
+		pageData["PrevURL"] = pageURL(r, "after", page.Prev)
+	}
+}
+
+// pageURL returns the current URL with the page cursor replaced by key=value.
+func pageURL(r *http.Request, key, value string) string {
+	query := r.URL.Query()
+	query.Del("before")
+	query.Del("after")
+	query.Set(key, value)
+	return r.URL.Path + "?" + query.Encode()
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// EditPostHandler shows the post form filled in with an existing post and
+// saves the changes. Only the author of the post may use it.
+func (app *App) EditPostHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		post, err := models.GetPostByID(r.URL.Query().Get("id"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound) // 404
+			app.RenderTemplate(w, r, "404", nil)
+			return
+		}
+		if post.UserID != user.ID {
+			http.Error(w, "Forbidden: you can only edit your own posts", http.StatusForbidden) // 403
+			return
+		}
+
+		var categoryIDs []int
+		for _, category := range post.Category {
+			categoryIDs = append(categoryIDs, category.ID)
+		}
+		app.renderPostForm(w, r, post.ID, post.Title, post.Content, categoryIDs, nil)
+
+	case http.MethodPost:
+		postID, err := strconv.Atoi(r.FormValue("post_id"))
+		if err != nil {
+			http.Error(w, "Bad request: Invalid PostID", http.StatusBadRequest) // 400
+			return
+		}
+		title := r.FormValue("title")
+		content := r.FormValue("content")
+		categoryIDs, err := parseCategoryIDs(r)
+		if err != nil {
+			http.Error(w, "Bad request: Invalid category", http.StatusBadRequest) // 400
+			return
+		}
+
+		err = models.UpdatePost(postID, user.ID, title, content, categoryIDs)
+		if errs := fieldErrors(err); errs != nil {
+			app.renderPostForm(w, r, postID, title, content, categoryIDs, errs)
+			return
+		}
+		if err != nil {
+			app.postError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/Post?id="+strconv.Itoa(postID), http.StatusSeeOther) // 303
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderPostForm shows the post form: empty for a new post when postID is 0,
+// or filled in for editing post postID. errs holds the field errors of a
+// refused submission, which is shown again with a 400.
+func (app *App) renderPostForm(w http.ResponseWriter, r *http.Request, postID int, title, content string, categoryIDs []int, errs map[string]string) {
+	user := currentUser(r)
+	checked := make(map[int]bool)
+	for _, id := range categoryIDs {
+		checked[id] = true
+	}
+	Catagories, _ := models.GetAllCategories()
+	var categoryDetails []map[string]interface{}
+	for _, Catagory := range Catagories {
+		categoryDetail := map[string]interface{}{
+			"ID":       Catagory.ID,
+			"Catagory": Catagory.Name,
+			"Checked":  checked[Catagory.ID],
+		}
+		categoryDetails = append(categoryDetails, categoryDetail)
+	}
+
+	pageData := make(map[string]interface{})
+	pageData["UserID"] = user.Username
+	pageData["PostID"] = postID
+	pageData["PostTitle"] = title
+	pageData["PostContent"] = content
+	pageData["Catagories"] = categoryDetails
+	pageData["Errors"] = errs
+	if errs != nil {
+		w.WriteHeader(http.StatusBadRequest) // 400
+	}
+	app.RenderTemplate(w, r, "createPost", pageData)
+}
+
+// DeletePostHandler removes a post, with everything attached to it, on
+// behalf of its author.
+func (app *App) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("post_id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid PostID", http.StatusBadRequest) // 400
+		return
+	}
+	if err := models.DeletePost(postID, user.ID); err != nil {
+		app.postError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/myposts", http.StatusSeeOther) // 303
+}
+
+// postError answers a failed UpdatePost or DeletePost.
+func (app *App) postError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrPostNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+		app.RenderTemplate(w, r, "404", nil)
+	case errors.Is(err, models.ErrNotPostAuthor):
+		http.Error(w, "Forbidden: you can only change your own posts", http.StatusForbidden) // 403
+	default:
+		log.Println("Error changing post:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+	}
+}
+
+// parseCategoryIDs reads the categories[] checkboxes of the post form.
+func parseCategoryIDs(r *http.Request) ([]int, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	var categoryIDs []int
+	for _, category := range r.Form["categories[]"] {
+		categoryID, err := strconv.Atoi(category)
+		if err != nil {
+			return nil, err
+		}
+		categoryIDs = append(categoryIDs, categoryID)
+	}
+	return categoryIDs, nil
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"Forum/config"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ipBurstFactor scales the budgets kept per IP address, so a few users
+// behind one address don't use up each other's budget.
+const ipBurstFactor = 4
+
+// RateLimiter hands out tokens from per-key token buckets. Every request
+// goroutine uses it, so implementations must be safe for concurrent use.
+type RateLimiter interface {
+	// Allow takes a token for each charge, from all of their buckets or from
+	// none: when any bucket is empty it takes nothing and returns false and
+	// how long until every bucket has a token again.
+	Allow(charges ...Charge) (bool, time.Duration)
+}
+
+// Charge is a token to take from the bucket of Key, which holds up to
+// Limit.Count tokens and regains Limit.Count every Limit.Per. A zero Limit
+// never refuses.
+type Charge struct {
+	Key   string
+	Limit config.RateLimit
+}
+
+// --- In-memory limiter ---
+
+// MemoryRateLimiter keeps the buckets in process memory, so budgets start
+// over on restart and aren't shared between several server processes.
+type MemoryRateLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time // when tokens was last brought up to date
+	full    time.Time // when the bucket will be full again and can be forgotten
+}
+
+// sweepEvery is how often MemoryRateLimiter drops buckets that refilled.
+const sweepEvery = time.Minute
+
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return newMemoryRateLimiter(time.Now)
+}
+
+// newMemoryRateLimiter takes the clock as a parameter so tests can move time.
+func newMemoryRateLimiter(now func() time.Time) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		buckets:   map[string]*bucket{},
+		now:       now,
+		lastSweep: now(),
+	}
+}
+
+func (l *MemoryRateLimiter) Allow(charges ...Charge) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	// Bring every bucket up to date before taking from any of them
+	type take struct {
+		b        *bucket
+		capacity float64
+		interval time.Duration // time to regain one token
+	}
+	var wait time.Duration
+	var takes []take
+	for _, c := range charges {
+		if c.Limit.Count <= 0 || c.Limit.Per <= 0 {
+			continue
+		}
+		capacity := float64(c.Limit.Count)
+		interval := c.Limit.Per / time.Duration(c.Limit.Count)
+		b, exists := l.buckets[c.Key]
+		if !exists {
+			b = &bucket{tokens: capacity, updated: now, full: now}
+			l.buckets[c.Key] = b
+		}
+		b.tokens = math.Min(capacity, b.tokens+float64(now.Sub(b.updated))/float64(interval))
+		b.updated = now
+		if b.tokens < 1 {
+			wait = max(wait, time.Duration((1-b.tokens)*float64(interval)))
+		}
+		takes = append(takes, take{b, capacity, interval})
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for _, t := range takes {
+		t.b.tokens--
+		t.b.full = now.Add(time.Duration((t.capacity - t.b.tokens) * float64(t.interval)))
+	}
+	return true, 0
+}
+
+// sweep forgets buckets that are full again; the caller must hold l.mu.
+func (l *MemoryRateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepEvery {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if !now.Before(b.full) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// --- Middleware ---
+
+// RateLimit refuses state-changing requests once the user, or the client's
+// IP address, used up the budget for kind ("login", "post", "comment",
+// "reaction" or "report"; registering shares the login budget). Refused requests get a
+// 429 with a Retry-After header. Form pages loaded with GET don't count.
+func (app *App) RateLimit(kind string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+		limit := app.rateLimit(kind)
+		ipLimit := config.RateLimit{Count: limit.Count * ipBurstFactor, Per: limit.Per}
+
+		// A request refused by one budget doesn't cost anything from the
+		// other: a user behind a busy shared address keeps their own
+		charges := []Charge{{Key: kind + ":ip:" + app.clientIP(r), Limit: ipLimit}}
+		if user := currentUser(r); user != nil {
+			charges = append(charges, Charge{Key: kind + ":user:" + strconv.Itoa(user.ID), Limit: limit})
+		}
+		if allowed, wait := app.Limiter.Allow(charges...); !allowed {
+			tooManyRequests(w, r, wait)
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (app *App) rateLimit(kind string) config.RateLimit {
+	switch kind {
+	case "login":
+		return app.Config.RateLogin
+	case "post":
+		return app.Config.RatePost
+	case "comment":
+		return app.Config.RateComment
+	case "reaction":
+		return app.Config.RateReaction
+	case "report":
+		return app.Config.RateReport
+	}
+	return config.RateLimit{}
+}
+
+// tooManyRequests answers a request refused by the rate limiter.
+func tooManyRequests(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	seconds := retryAfter(w, wait)
+	message := "Too many requests, try again in " + strconv.Itoa(seconds) + " seconds"
+	if wantsJSON(r) {
+		writeAPIError(w, http.StatusTooManyRequests, "rate_limited", message) // 429
+		return
+	}
+	http.Error(w, message, http.StatusTooManyRequests) // 429
+}
+
+// retryAfter sets the Retry-After header to wait, rounded up to whole
+// seconds, and returns the seconds.
+func retryAfter(w http.ResponseWriter, wait time.Duration) int {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	return seconds
+}
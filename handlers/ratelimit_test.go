@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"Forum/config"
+	"Forum/models"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock the tests move by hand.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func TestMemoryRateLimiterBurstAndRefill(t *testing.T) {
+	clock := newFakeClock()
+	l := newMemoryRateLimiter(clock.now)
+	limit := config.RateLimit{Count: 3, Per: time.Minute}
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow(Charge{"k", limit}); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	ok, wait := l.Allow(Charge{"k", limit})
+	if ok {
+		t.Fatal("request past the burst allowed")
+	}
+	if wait != 20*time.Second {
+		t.Errorf("wait = %v, want 20s", wait)
+	}
+
+	clock.advance(15 * time.Second)
+	if ok, wait := l.Allow(Charge{"k", limit}); ok || wait != 5*time.Second {
+		t.Errorf("after 15s: ok = %v, wait = %v; want refused with 5s left", ok, wait)
+	}
+	clock.advance(5 * time.Second)
+	if ok, _ := l.Allow(Charge{"k", limit}); !ok {
+		t.Error("request refused after a token came back")
+	}
+	if ok, _ := l.Allow(Charge{"k", limit}); ok {
+		t.Error("second request allowed with only one token back")
+	}
+
+	// A long pause refills the bucket, but only up to the burst.
+	clock.advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.Allow(Charge{"k", limit}); !ok {
+			t.Fatalf("request %d after the pause refused", i+1)
+		}
+	}
+	if ok, _ := l.Allow(Charge{"k", limit}); ok {
+		t.Error("bucket refilled past its burst")
+	}
+}
+
+func TestMemoryRateLimiterKeys(t *testing.T) {
+	clock := newFakeClock()
+	l := newMemoryRateLimiter(clock.now)
+	limit := config.RateLimit{Count: 1, Per: time.Minute}
+
+	if ok, _ := l.Allow(Charge{"post:user:1", limit}); !ok {
+		t.Fatal("first request refused")
+	}
+	if ok, _ := l.Allow(Charge{"post:user:1", limit}); ok {
+		t.Error("second request on the same key allowed")
+	}
+	if ok, _ := l.Allow(Charge{"post:user:2", limit}); !ok {
+		t.Error("another key shares the budget")
+	}
+	if ok, _ := l.Allow(Charge{"anything", config.RateLimit{}}); !ok {
+		t.Error("a disabled limit refused a request")
+	}
+}
+
+func TestMemoryRateLimiterChargesAllOrNothing(t *testing.T) {
+	clock := newFakeClock()
+	l := newMemoryRateLimiter(clock.now)
+	one := config.RateLimit{Count: 1, Per: time.Minute}
+	two := config.RateLimit{Count: 2, Per: time.Minute}
+
+	l.Allow(Charge{"empty", one})
+	for i := 0; i < 3; i++ {
+		if ok, wait := l.Allow(Charge{"full", two}, Charge{"empty", one}); ok || wait != time.Minute {
+			t.Fatalf("charge on an empty bucket: allowed %v, wait %s", ok, wait)
+		}
+	}
+	// Refused charges took nothing from the other bucket
+	if ok, _ := l.Allow(Charge{"full", two}); !ok {
+		t.Fatal("full bucket drained by refused charges")
+	}
+	if ok, _ := l.Allow(Charge{"full", two}); !ok {
+		t.Fatal("full bucket drained by refused charges")
+	}
+}
+
+func TestMemoryRateLimiterSweep(t *testing.T) {
+	clock := newFakeClock()
+	l := newMemoryRateLimiter(clock.now)
+	limit := config.RateLimit{Count: 2, Per: time.Minute}
+
+	l.Allow(Charge{"a", limit})
+	l.Allow(Charge{"b", limit})
+	l.Allow(Charge{"b", limit})
+	clock.advance(sweepEvery)
+	l.Allow(Charge{"c", limit})
+
+	// "a" was full again after 30s and "b" after a minute; only "c" is left.
+	if len(l.buckets) != 1 || l.buckets["c"] == nil {
+		t.Errorf("buckets after the sweep = %v, want only c", l.buckets)
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	clock := newFakeClock()
+	app := &App{
+		Config:  &config.Config{RatePost: config.RateLimit{Count: 1, Per: time.Minute}},
+		Limiter: newMemoryRateLimiter(clock.now),
+	}
+	handler := app.RateLimit("post", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	send := func(method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	// The IP budget is ipBurstFactor times the per-user one.
+	for i := 0; i < ipBurstFactor; i++ {
+		if w := send(http.MethodPost, "/createPost"); w.Code != http.StatusCreated {
+			t.Fatalf("request %d: status %d, want 201", i+1, w.Code)
+		}
+	}
+	w := send(http.MethodPost, "/createPost")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "15" {
+		t.Errorf("Retry-After = %q, want 15", got)
+	}
+
+	w = send(http.MethodPost, "/api/v1/posts")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("API answer: status %d, Content-Type %q; want a JSON 429", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	if w := send(http.MethodGet, "/createPost"); w.Code != http.StatusCreated {
+		t.Errorf("GET was limited: status %d", w.Code)
+	}
+
+	clock.advance(15 * time.Second)
+	if w := send(http.MethodPost, "/createPost"); w.Code != http.StatusCreated {
+		t.Errorf("after Retry-After: status %d, want 201", w.Code)
+	}
+}
+
+// A user behind an address others have used up is turned away without
+// losing any of their own budget.
+func TestRateLimitMiddlewareSharedAddress(t *testing.T) {
+	clock := newFakeClock()
+	app := &App{
+		Config:  &config.Config{RatePost: config.RateLimit{Count: 1, Per: time.Minute}},
+		Limiter: newMemoryRateLimiter(clock.now),
+	}
+	handler := app.RateLimit("post", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	send := func(user *models.User) int {
+		r := httptest.NewRequest(http.MethodPost, "/createPost", nil)
+		r.RemoteAddr = "192.0.2.1:1234"
+		if user != nil {
+			r = r.WithContext(context.WithValue(r.Context(), userContextKey{}, user))
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	for i := 0; i < ipBurstFactor; i++ {
+		send(nil)
+	}
+	alice := &models.User{ID: 1}
+	for i := 0; i < 3; i++ {
+		if status := send(alice); status != http.StatusTooManyRequests {
+			t.Fatalf("busy address: status %d, want 429", status)
+		}
+	}
+	// The address regains a token long before alice would have
+	clock.advance(time.Minute / ipBurstFactor)
+	if status := send(alice); status != http.StatusCreated {
+		t.Errorf("after the address recovered: status %d, want 201", status)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies, err := config.ParseTrustedProxies("10.0.0.0/8, 192.0.2.7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := &App{Config: &config.Config{TrustedProxies: proxies}}
+	tests := []struct {
+		remote, forwarded, want string
+	}{
+		{"198.51.100.1:1234", "", "198.51.100.1"},
+		// Only trusted proxies are believed
+		{"198.51.100.1:1234", "203.0.113.9", "198.51.100.1"},
+		{"192.0.2.7:1234", "203.0.113.9", "203.0.113.9"},
+		{"[::ffff:10.1.2.3]:1234", "203.0.113.9", "203.0.113.9"},
+		// The client can prepend whatever it likes; the proxies append
+		{"10.0.0.1:1234", "1.2.3.4, 203.0.113.9, 10.0.0.2", "203.0.113.9"},
+		{"10.0.0.1:1234", "not an ip, 10.0.0.2", "10.0.0.2"},
+		{"10.0.0.1:1234", "", "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		if got := app.clientIP(r); got != tt.want {
+			t.Errorf("%s forwarding %q: got %s, want %s", tt.remote, tt.forwarded, got, tt.want)
+		}
+	}
+	if _, err := config.ParseTrustedProxies("10.0.0.0/33"); err == nil {
+		t.Error("bad CIDR range accepted")
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// formReaction reads the reaction a button submitted: reaction=<name> from
+// the reaction buttons, or like=1 / like=-1 from older forms.
+func (app *App) formReaction(r *http.Request) (string, bool) {
+	reaction := r.FormValue("reaction")
+	switch r.FormValue("like") {
+	case "1":
+		reaction = models.ReactionLike
+	case "-1":
+		reaction = models.ReactionDislike
+	}
+	return reaction, app.Config.HasReaction(reaction)
+}
+
+// reactionButtons lists the configured reactions with their counts for the
+// reaction buttons of a post or comment.
+func (app *App) reactionButtons(reactions models.Reactions) []map[string]interface{} {
+	var buttons []map[string]interface{}
+	for _, reaction := range app.Config.Reactions {
+		buttons = append(buttons, map[string]interface{}{
+			"Name":  reaction.Name,
+			"Emoji": reaction.Emoji,
+			"Count": reactions.Counts[reaction.Name],
+			"Mine":  reactions.Mine == reaction.Name,
+		})
+	}
+	return buttons
+}
+
+// reactionError answers a reaction that could not be saved.
+func (app *App) reactionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, models.ErrPostNotFound), errors.Is(err, models.ErrCommentNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+		app.RenderTemplate(w, r, "404", nil)
+	default:
+		log.Println("Error saving reaction:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+	}
+}
+
+// viewerID is the ID of the user making the request, or 0.
+func viewerID(r *http.Request) int {
+	if user := currentUser(r); user != nil {
+		return user.ID
+	}
+	return 0
+}
@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// notificationsShown is how many notifications the notifications page lists.
+const notificationsShown = 50
+
+// unreadNotifications counts the logged in user's unread notifications for
+// the navbar; 0 for visitors.
+func unreadNotifications(r *http.Request) int {
+	user := currentUser(r)
+	if user == nil {
+		return 0
+	}
+	n, err := models.CountUnreadNotifications(user.ID)
+	if err != nil {
+		log.Println("Error counting notifications:", err)
+	}
+	return n
+}
+
+// ReportHandler files a report of a post or comment for the logged in user.
+func (app *App) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid ID", http.StatusBadRequest) // 400
+		return
+	}
+	reason := r.FormValue("reason")
+	switch r.FormValue("target") {
+	case "post":
+		_, err = models.ReportPost(user.ID, id, reason, app.Config.ReportThreshold)
+		if err == nil {
+			http.Redirect(w, r, "/Post?id="+strconv.Itoa(id), http.StatusSeeOther) // 303
+			return
+		}
+	case "comment":
+		_, err = models.ReportComment(user.ID, id, reason, app.Config.ReportThreshold)
+		if err == nil {
+			app.redirectToCommentPost(w, r, id)
+			return
+		}
+	default:
+		http.Error(w, "Bad request: Invalid report target", http.StatusBadRequest) // 400
+		return
+	}
+	app.reportError(w, r, err)
+}
+
+// reportError answers a failed ReportPost or ReportComment.
+func (app *App) reportError(w http.ResponseWriter, r *http.Request, err error) {
+	var invalid models.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		http.Error(w, "Bad request: "+invalid["reason"], http.StatusBadRequest) // 400
+	case errors.Is(err, models.ErrPostNotFound), errors.Is(err, models.ErrCommentNotFound):
+		w.WriteHeader(http.StatusNotFound) // 404
+		app.RenderTemplate(w, r, "404", nil)
+	case errors.Is(err, models.ErrAlreadyReported):
+		http.Error(w, "Conflict: You already reported this; a moderator will look at it", http.StatusConflict) // 409
+	case errors.Is(err, models.ErrReportReasonRequired):
+		http.Error(w, "Bad request: Missing reason", http.StatusBadRequest) // 400
+	default:
+		log.Println("Error filing report:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+	}
+}
+
+// ReportQueueHandler shows the moderation queue: everything with open
+// reports, the most reported first.
+func (app *App) ReportQueueHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	queue, err := models.GetReportQueue()
+	if err != nil {
+		log.Println("Error reading the report queue:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+
+	var items []map[string]interface{}
+	for _, item := range queue {
+		var reports []map[string]interface{}
+		for _, report := range item.Reports {
+			reports = append(reports, map[string]interface{}{
+				"Reporter":  report.Reporter,
+				"Reason":    report.Reason,
+				"CreatedAt": report.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+			})
+		}
+		link := ""
+		if item.PostID != 0 {
+			link = "/Post?id=" + strconv.Itoa(item.PostID)
+			if item.Target == "comment" {
+				link += "#comment-" + strconv.Itoa(item.TargetID)
+			}
+		}
+		items = append(items, map[string]interface{}{
+			"Target":   item.Target,
+			"TargetID": item.TargetID,
+			"Link":     link,
+			"Title":    item.Title,
+			"Content":  item.Content,
+			"Author":   item.Author,
+			"Hidden":   item.Hidden,
+			"Deleted":  item.Deleted,
+			"Count":    len(item.Reports),
+			"Reports":  reports,
+		})
+	}
+
+	pageData := make(map[string]interface{})
+	pageData["UserID"] = user.Username
+	pageData["Items"] = items
+	pageData["Threshold"] = app.Config.ReportThreshold
+	app.RenderTemplate(w, r, "reports", pageData)
+}
+
+// ResolveReportHandler closes the open reports on a post or comment as
+// resolved or dismissed; the reporters are notified.
+func (app *App) ResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil {
+		http.Error(w, "Bad request: Invalid ID", http.StatusBadRequest) // 400
+		return
+	}
+	if err := models.ResolveReports(user.ID, r.FormValue("target"), id, r.FormValue("resolution"), r.FormValue("reason")); err != nil {
+		app.modError(w, r, err)
+		return
+	}
+	http.Redirect(w, r, "/mod/reports", http.StatusSeeOther) // 303
+}
+
+// NotificationsHandler lists the user's notifications and marks them read.
+func (app *App) NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	notifications, err := models.GetNotifications(user.ID, notificationsShown)
+	if err == nil {
+		err = models.MarkNotificationsRead(user.ID)
+	}
+	if err != nil {
+		log.Println("Error reading notifications:", err)
+		w.WriteHeader(http.StatusInternalServerError) // 500
+		app.RenderTemplate(w, r, "500", nil)
+		return
+	}
+
+	var details []map[string]interface{}
+	for _, n := range notifications {
+		details = append(details, map[string]interface{}{
+			"Message":   n.Message,
+			"Link":      n.Link,
+			"Unread":    !n.Read,
+			"CreatedAt": n.CreatedAt.Local().Format("2006-01-02 15:04:05"),
+		})
+	}
+
+	pageData := make(map[string]interface{})
+	pageData["UserID"] = user.Username
+	pageData["Notifications"] = details
+	app.RenderTemplate(w, r, "notifications", pageData)
+}
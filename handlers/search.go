@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"Forum/models"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// SearchHandler shows the search form and, given ?q=, the matching posts
+// and comments.
+func (app *App) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	user := currentUser(r)
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed) // 405
+		return
+	}
+
+	input := strings.TrimSpace(r.URL.Query().Get("q"))
+	pageData := make(map[string]interface{})
+	pageData["IsLoggedIn"] = user != nil
+	if user != nil {
+		pageData["UserID"] = user.Username
+	}
+	pageData["Query"] = input
+
+	if input != "" {
+		results, err := models.Search(models.ParseSearchQuery(input))
+		if err != nil {
+			// ParseSearchQuery quotes every term, so no input makes a bad
+			// MATCH expression: this is the database failing
+			log.Println("Error searching:", err)
+			w.WriteHeader(http.StatusInternalServerError) // 500
+			app.RenderTemplate(w, r, "500", nil)
+			return
+		}
+
+		var resultDetails []map[string]interface{}
+		for _, result := range results {
+			resultDetail := map[string]interface{}{
+				"PostID":    result.PostID,
+				"CommentID": result.CommentID,
+				"IsComment": result.Kind == "comment",
+				"Title":     result.Title,
+				"Author":    result.Author,
+				"Snippet":   highlight(result.Snippet),
+			}
+			resultDetails = append(resultDetails, resultDetail)
+		}
+		pageData["Results"] = resultDetails
+		pageData["Searched"] = true
+	}
+	app.RenderTemplate(w, r, "search", pageData)
+}
+
+// highlight escapes a search snippet and turns its match markers into <mark>
+// tags.
+func highlight(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, models.HighlightStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, models.HighlightEnd, "</mark>")
+	return template.HTML(escaped)
+}
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"Forum/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestSearchHandler(t *testing.T) {
+	a := newAPITest(t)
+	a.createPost(a.register("alice"))
+	search := func(q string) int {
+		rec := httptest.NewRecorder()
+		a.handler.ServeHTTP(rec, httptest.NewRequest("GET", "/search?q="+url.QueryEscape(q), nil))
+		return rec.Code
+	}
+
+	for _, q := range []string{"content", `NOT (x OR "`, "title:* NEAR(a b)", "author:alice"} {
+		if status := search(q); status != http.StatusOK {
+			t.Errorf("%q: status %d, want 200", q, status)
+		}
+	}
+	// A broken database is the server's fault, not the query's
+	models.CloseDB()
+	if status := search("content"); status != http.StatusInternalServerError {
+		t.Errorf("without a database: status %d, want 500", status)
+	}
+}
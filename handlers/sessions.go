@@ -1,79 +1,336 @@
 package handlers
 
 import (
+	"Forum/models"
+	"errors"
+	"log"
+	"net"
 	"net/http"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
-	// "strconv"
 )
-var sessions = map[string]string{} // key is the session ID, value is the user ID
-
-var userSessions = map[string]string{}
-
-
-func CreateSession(w http.ResponseWriter, userID string) {
-    // Generate a new UUID for the session ID
-    sessionID := uuid.NewString()
-
-    if existingSessionID, exists := userSessions[userID]; exists {
-        delete(sessions, existingSessionID)
-		http.SetCookie(w, &http.Cookie{
-			Name:     "session_id",
-			Value:    "",
-			Expires:  time.Now().Add(-1 * time.Hour), // Expire the old session cookie immediately
-			HttpOnly: true,
-		})
-    }
-    
-    // Store the session ID and associated userID in the session store
-    sessions[sessionID] = userID
-    userSessions[userID] = sessionID
-
-    // Set a cookie with the session ID
-    http.SetCookie(w, &http.Cookie{
-        Name:     "session_id",
-        Value:    sessionID,
-        Expires:  time.Now().Add(24 * time.Hour), // Set the expiration to 24 hours
-        HttpOnly: true,                           // Make it inaccessible via JavaScript
-    })
-}
-
-func GetUserIDFromSession(r *http.Request) (string, bool) {
-    cookie, err := r.Cookie("session_id")
-    if err != nil {
-        return "", false
-    }
-    
-    // Check if session ID exists in the session store
-    userID, exists := sessions[cookie.Value]
-    if !exists {
-        return "", false
-    }
-
-    return userID, true
-}
-
-// after the user log we delete 
-func DestroySession(w http.ResponseWriter, r *http.Request) {
-    cookie, err := r.Cookie("session_id")
-    if err != nil {
-        return
-    }
-
-    userID, exists := sessions[cookie.Value]
+
+const sessionCookieName = "session_id"
+
+// SessionStore keeps track of logged in users. Every request goroutine reads
+// and writes sessions, so implementations must be safe for concurrent use.
+type SessionStore interface {
+	// Create starts a new session. A user may hold any number of sessions.
+	Create(session models.Session) error
+	// Get returns the user owning sessionID if the session has not expired,
+	// and marks the session as seen.
+	Get(sessionID string) (int, bool)
+	// Delete ends a single session.
+	Delete(sessionID string) error
+	// List returns the live sessions of a user, most recently used first.
+	// The sessions carry their Key, not their ID.
+	List(userID int) ([]models.Session, error)
+	// DeleteKey ends the session of a user with the given Key, if any.
+	DeleteKey(userID int, key string) error
+	// DeleteAll ends every session of a user.
+	DeleteAll(userID int) error
+	// Flush persists anything the store still holds in memory and drops
+	// expired sessions. It is called once while the server shuts down.
+	Flush() error
+}
+
+// --- In-memory store ---
+
+// MemorySessionStore keeps sessions in process memory. Sessions are lost on
+// restart, so it is mostly useful for tests and local development.
+type MemorySessionStore struct {
+	mu           sync.Mutex
+	sessions     map[string]*models.Session  // key is the session ID
+	userSessions map[int]map[string]struct{} // key is the user ID, values are session IDs
+}
+
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		sessions:     map[string]*models.Session{},
+		userSessions: map[int]map[string]struct{}{},
+	}
+}
+
+func (s *MemorySessionStore) Create(session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	session.CreatedAt = now
+	session.LastSeen = now
+	s.sessions[session.ID] = &session
+	if s.userSessions[session.UserID] == nil {
+		s.userSessions[session.UserID] = map[string]struct{}{}
+	}
+	s.userSessions[session.UserID][session.ID] = struct{}{}
+	return nil
+}
+
+func (s *MemorySessionStore) Get(sessionID string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionID]
+	if !exists {
+		return 0, false
+	}
+	now := time.Now()
+	if !now.Before(session.ExpiresAt) {
+		s.remove(sessionID)
+		return 0, false
+	}
+	session.LastSeen = now
+	return session.UserID, true
+}
+
+func (s *MemorySessionStore) Delete(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(sessionID)
+	return nil
+}
+
+func (s *MemorySessionStore) List(userID int) ([]models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sessions []models.Session
+	now := time.Now()
+	for sessionID := range s.userSessions[userID] {
+		session := *s.sessions[sessionID]
+		if !now.Before(session.ExpiresAt) {
+			s.remove(sessionID)
+			continue
+		}
+		session.ID, session.Key = "", models.SessionKey(sessionID)
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeen.After(sessions[j].LastSeen)
+	})
+	return sessions, nil
+}
+
+func (s *MemorySessionStore) DeleteKey(userID int, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionID := range s.userSessions[userID] {
+		if models.SessionKey(sessionID) == key {
+			s.remove(sessionID)
+		}
+	}
+	return nil
+}
+
+func (s *MemorySessionStore) DeleteAll(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionID := range s.userSessions[userID] {
+		delete(s.sessions, sessionID)
+	}
+	delete(s.userSessions, userID)
+	return nil
+}
+
+// Flush drops expired sessions. Nothing outlives the process anyway.
+func (s *MemorySessionStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for sessionID, session := range s.sessions {
+		if !now.Before(session.ExpiresAt) {
+			s.remove(sessionID)
+		}
+	}
+	return nil
+}
+
+// remove deletes a session; the caller must hold s.mu.
+func (s *MemorySessionStore) remove(sessionID string) {
+	session, exists := s.sessions[sessionID]
 	if !exists {
 		return
 	}
-    // Delete session from the session store
-    delete(sessions, cookie.Value)
-
-    delete(userSessions, userID)
-    // Expire the cookie
-    http.SetCookie(w, &http.Cookie{
-        Name:     "session_id",
-        Value:    "",
-        Expires:  time.Now().Add(-1 * time.Hour), // Expire the cookie immediately
-        HttpOnly: true,
-    })
+	delete(s.sessions, sessionID)
+	delete(s.userSessions[session.UserID], sessionID)
+	if len(s.userSessions[session.UserID]) == 0 {
+		delete(s.userSessions, session.UserID)
+	}
+}
+
+// --- SQLite store ---
+
+// SQLiteSessionStore keeps sessions in the sessions table so they survive
+// restarts. The table holds models.SessionKey of each ID rather than the ID
+// itself. models.InitDB must have been called before it is used.
+type SQLiteSessionStore struct{}
+
+func NewSQLiteSessionStore() *SQLiteSessionStore {
+	return &SQLiteSessionStore{}
+}
+
+func (SQLiteSessionStore) Create(session models.Session) error {
+	return models.CreateSession(session)
+}
+
+// Get treats a session it can't read as logged out, logging why unless the
+// session simply doesn't exist.
+func (SQLiteSessionStore) Get(sessionID string) (int, bool) {
+	userID, err := models.GetSession(sessionID)
+	if err != nil {
+		if !errors.Is(err, models.ErrSessionNotFound) {
+			log.Println("Error reading session:", err)
+		}
+		return 0, false
+	}
+	return userID, true
+}
+
+func (SQLiteSessionStore) Delete(sessionID string) error {
+	return models.DeleteSession(sessionID)
+}
+
+func (SQLiteSessionStore) List(userID int) ([]models.Session, error) {
+	return models.GetUserSessions(userID)
+}
+
+func (SQLiteSessionStore) DeleteKey(userID int, key string) error {
+	return models.DeleteUserSession(userID, key)
+}
+
+func (SQLiteSessionStore) DeleteAll(userID int) error {
+	return models.DeleteUserSessions(userID)
+}
+
+// Flush removes expired rows; every other change is already on disk.
+func (SQLiteSessionStore) Flush() error {
+	return models.DeleteExpiredSessions()
+}
+
+// --- Cookie helpers ---
+
+func (app *App) CreateSession(w http.ResponseWriter, r *http.Request, userID int) {
+	session, err := app.startSession(r, userID)
+	if err != nil {
+		log.Println("Error creating session:", err)
+		return
+	}
+
+	// Set a cookie with the session ID
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    session.ID,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,                 // Make it inaccessible via JavaScript
+		Secure:   r.TLS != nil,         // Only send it back over HTTPS when served over HTTPS
+		SameSite: http.SameSiteLaxMode, // Don't send it along with cross-site POSTs
+	})
+}
+
+// startSession stores a new session for userID, described by the client
+// making request r. The session ID doubles as the API bearer token.
+func (app *App) startSession(r *http.Request, userID int) (models.Session, error) {
+	// Generate a new UUID for the session ID
+	session := models.Session{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		UserAgent: r.UserAgent(),
+		IP:        app.clientIP(r),
+		ExpiresAt: time.Now().Add(app.Config.SessionLifetime),
+	}
+	return session, app.Sessions.Create(session)
+}
+
+func (app *App) GetUserIDFromSession(r *http.Request) (int, bool) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return 0, false
+	}
+	return app.Sessions.Get(cookie.Value)
+}
+
+// currentSessionID returns the session ID from the request cookie, if any.
+func currentSessionID(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// after the user log we delete
+func (app *App) DestroySession(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return
+	}
+
+	if err := app.Sessions.Delete(cookie.Value); err != nil {
+		log.Println("Error deleting session:", err)
+	}
+	expireSessionCookie(w)
+}
+
+func expireSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Now().Add(-1 * time.Hour), // Expire the cookie immediately
+		HttpOnly: true,
+	})
+}
+
+// clientIP returns the address of the client making r, without the port.
+// That is the remote end of the connection, unless it is one of the trusted
+// proxies: then it is the last address in X-Forwarded-For that isn't a
+// trusted proxy too. Anything left of that could be made up by the client.
+func (app *App) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !app.trustedProxy(host) {
+		return host
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		if _, err := netip.ParseAddr(hop); err != nil {
+			break // garbage; don't believe anything further left
+		}
+		host = hop
+		if !app.trustedProxy(hop) {
+			break
+		}
+	}
+	return host
+}
+
+// trustedProxy reports whether ip is one of the configured reverse proxies.
+func (app *App) trustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range app.Config.TrustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
 }
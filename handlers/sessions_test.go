@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"Forum/models"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSessionStore runs users goroutines at once, each creating, reading,
+// listing and deleting sessions of its own user, and checks every store call
+// sees what that goroutine did. Run it with -race.
+func testSessionStore(t *testing.T, store SessionStore, userIDs []int) {
+	const perUser = 10
+	var wg sync.WaitGroup
+	errs := make(chan string, len(userIDs)*perUser*2)
+	for _, userID := range userIDs {
+		wg.Add(1)
+		go func(userID int) {
+			defer wg.Done()
+			for i := 0; i < perUser; i++ {
+				id := strconv.Itoa(userID) + "-" + strconv.Itoa(i)
+				session := models.Session{ID: id, UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}
+				if err := store.Create(session); err != nil {
+					errs <- err.Error()
+					return
+				}
+				if got, ok := store.Get(id); !ok || got != userID {
+					errs <- "session " + id + " not found after Create"
+				}
+				if i%2 == 1 {
+					if err := store.Delete(id); err != nil {
+						errs <- err.Error()
+					}
+					if _, ok := store.Get(id); ok {
+						errs <- "session " + id + " found after Delete"
+					}
+				}
+				if _, err := store.List(userID); err != nil {
+					errs <- err.Error()
+				}
+			}
+		}(userID)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	for _, userID := range userIDs {
+		sessions, err := store.List(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != perUser/2 {
+			t.Errorf("user %d has %d sessions, want %d", userID, len(sessions), perUser/2)
+		}
+		// Lists name sessions by key; only the owner's key ends one
+		key := models.SessionKey(strconv.Itoa(userID) + "-0")
+		if sessions[len(sessions)-1].ID != "" {
+			t.Errorf("List gave away the session ID %q", sessions[len(sessions)-1].ID)
+		}
+		if err := store.DeleteKey(userID+1000, key); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store.Get(strconv.Itoa(userID) + "-0"); !ok {
+			t.Error("another user's DeleteKey ended the session")
+		}
+		if err := store.DeleteKey(userID, key); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := store.Get(strconv.Itoa(userID) + "-0"); ok {
+			t.Error("session survived DeleteKey")
+		}
+		if err := store.DeleteAll(userID); err != nil {
+			t.Fatal(err)
+		}
+		if sessions, _ := store.List(userID); len(sessions) != 0 {
+			t.Errorf("user %d has %d sessions after DeleteAll", userID, len(sessions))
+		}
+	}
+}
+
+func TestMemorySessionStoreConcurrent(t *testing.T) {
+	testSessionStore(t, NewMemorySessionStore(), []int{1, 2, 3, 4, 5, 6, 7, 8})
+}
+
+func TestSQLiteSessionStoreConcurrent(t *testing.T) {
+	models.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	t.Cleanup(func() { models.CloseDB() })
+
+	var userIDs []int
+	for i := 0; i < 8; i++ {
+		name := "user" + strconv.Itoa(i)
+		if err := models.CreateUser(models.User{Email: name + "@example.com", Username: name, Password: "x"}); err != nil {
+			t.Fatal(err)
+		}
+		user, err := models.GetUserByUserName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		userIDs = append(userIDs, user.ID)
+	}
+	testSessionStore(t, NewSQLiteSessionStore(), userIDs)
+}
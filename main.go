@@ -1,52 +1,124 @@
 package main
+
 import (
+	"Forum/config"
 	"Forum/handlers"
 	"Forum/models"
-	// "html/template"
+	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
-// var templates *template.Template
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
-    handlers.RenderTemplate(w, "register", nil)
-}
 
+// --- Main Function ---
+func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
 
+	// Initialize the database
+	models.InitDB(cfg.DatabaseDSN)
+	if cfg.Migrate {
+		if err := models.CloseDB(); err != nil {
+			log.Println("Error closing database:", err)
+		}
+		return
+	}
+	if cfg.SetRole != "" {
+		username, role, _ := strings.Cut(cfg.SetRole, "=")
+		if err := models.SetUserRoleByName(username, role); err != nil {
+			log.Fatalf("Setting the role of %s: %v", username, err)
+		}
+		log.Printf("%s is now %s", username, role)
+		if err := models.CloseDB(); err != nil {
+			log.Println("Error closing database:", err)
+		}
+		return
+	}
 
+	mailer, closeMailer, err := newMailer(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	app, err := handlers.New(cfg, handlers.NewSQLiteSessionStore(), mailer)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-// --- Main Function ---
-func NotFoundHandler(w http.ResponseWriter, r *http.Request) {
-    w.WriteHeader(http.StatusNotFound)
-    handlers.RenderTemplate(w, "404", nil)
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           app.Routes(),
+		ReadHeaderTimeout: cfg.ReadTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if cfg.TLS() {
+			log.Printf("Server is running on %s with TLS", cfg.Addr)
+			serverErr <- srv.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			log.Printf("Server is running on %s", cfg.Addr)
+			serverErr <- srv.ListenAndServe()
+		}
+	}()
+
+	// Wait for Ctrl+C or a SIGTERM from Docker
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server: ", err)
+		}
+	case <-ctx.Done():
+		log.Println("Shutting down, waiting for in-flight requests")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error draining connections:", err)
+	}
+	if err := app.Sessions.Flush(); err != nil {
+		log.Println("Error flushing sessions:", err)
+	}
+	if err := app.WaitForMail(shutdownCtx); err != nil {
+		log.Println("Error waiting for emails to go out:", err)
+	}
+	if err := closeMailer(); err != nil {
+		log.Println("Error closing mail file:", err)
+	}
+	if err := models.CloseDB(); err != nil {
+		log.Println("Error closing database:", err)
+	}
+	log.Println("Server stopped")
 }
 
-func main() {
-		// Initialize the database
-		models.InitDB()
-	
-    // Routes
-    http.HandleFunc("/", handlers.HomeHandler)
-    http.HandleFunc("/home", handlers.HomeHandler)
-    http.HandleFunc("/register", handlers.RegisterHandler)
-    http.HandleFunc("/login", handlers.LoginHandler)
-	http.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
-		handlers.DestroySession(w, r)
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-	})
-	http.HandleFunc("/createPost", handlers.CreatePostHandler)
-	http.HandleFunc("/Post", handlers.ViewPostHandler)
-	http.HandleFunc("/myposts", handlers.CreatedPostsHandler)
-    http.HandleFunc("/LikedPosts", handlers.LikedPostsHandler)
-    http.HandleFunc("/CategoryViewer", handlers.CatagoryHandler)
-    http.HandleFunc("/Comment", handlers.CommentHandler)
-    http.HandleFunc("/Like", handlers.LikeHandler)
-    http.HandleFunc("/CommentLike", handlers.LikeCommentHandler)
-
-
-    // Serve static files
-    http.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
-    log.Println("Server is running on http://localhost:8080")
-    if err := http.ListenAndServe(":8080", nil); err != nil {
-        log.Fatal("Failed to start server: ", err)
-    }
+// newMailer sends email through the SMTP server if one is configured.
+// Otherwise emails are appended to the mail file, or written to the log,
+// so links can be copied from there during development.
+func newMailer(cfg *config.Config) (handlers.Mailer, func() error, error) {
+	if cfg.SMTPAddr != "" {
+		return handlers.NewSMTPMailer(cfg.SMTPAddr, cfg.MailFrom, cfg.SMTPUsername, cfg.SMTPPassword), func() error { return nil }, nil
+	}
+	if cfg.MailFile != "" {
+		f, err := os.OpenFile(cfg.MailFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, nil, fmt.Errorf("opening mail file: %w", err)
+		}
+		return handlers.NewLogMailer(cfg.MailFrom, f), f.Close, nil
+	}
+	log.Println("No SMTP server configured; emails are written to the log")
+	return handlers.NewLogMailer(cfg.MailFrom, log.Writer()), func() error { return nil }, nil
 }
@@ -0,0 +1,94 @@
+// Package migrations keeps the forum database schema up to date. Every schema
+// change is a numbered migration that runs exactly once per database; the
+// versions already applied are recorded in the schema_migrations table.
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Migration is a single schema change. Up runs inside a transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+}
+
+const createVersionTable = `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        name TEXT NOT NULL,
+        applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`
+
+// Apply runs every migration in All that has not been applied to db yet, in
+// version order, and returns how many were applied.
+func Apply(db *sql.DB) (int, error) {
+	return apply(db, All)
+}
+
+func apply(db *sql.DB, migrations []Migration) (int, error) {
+	if _, err := db.Exec(createVersionTable); err != nil {
+		return 0, fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+
+	applied, err := AppliedVersions(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	last := 0
+	for _, m := range migrations {
+		if m.Version <= last {
+			return count, fmt.Errorf("migration %d (%s) is out of order", m.Version, m.Name)
+		}
+		last = m.Version
+		if applied[m.Version] {
+			continue
+		}
+		if err := applyOne(db, m); err != nil {
+			return count, err
+		}
+		log.Printf("Applied migration %d: %s", m.Version, m.Name)
+		count++
+	}
+	return count, nil
+}
+
+func applyOne(db *sql.DB, m Migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.Up); err != nil {
+		return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.Version, m.Name); err != nil {
+		return fmt.Errorf("failed to record migration %d: %w", m.Version, err)
+	}
+	return tx.Commit()
+}
+
+// AppliedVersions returns the set of migration versions recorded in db.
+func AppliedVersions(db *sql.DB) (map[int]bool, error) {
+	rows, err := db.Query("SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,185 @@
+package migrations
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+// legacySchema is the schema CreateTables used to build before migrations
+// existed, together with the categories InitDB seeded.
+const legacySchema = `
+    CREATE TABLE IF NOT EXISTS users (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        email TEXT UNIQUE NOT NULL,
+        username TEXT UNIQUE NOT NULL,
+        password TEXT NOT NULL
+    );
+    CREATE TABLE IF NOT EXISTS posts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER,
+        title TEXT NOT NULL,
+        content TEXT NOT NULL,
+        Author Text NOT NULL,
+        Category TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+    CREATE TABLE IF NOT EXISTS comments (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        post_id INTEGER,
+        user_id INTEGER,
+        Author Text NOT NULL,
+        comment TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(post_id) REFERENCES posts(id),
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+    CREATE TABLE IF NOT EXISTS likes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        post_id INTEGER,
+        user_id INTEGER,
+        is_like INTEGER,
+        FOREIGN KEY(post_id) REFERENCES posts(id),
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+    CREATE TABLE IF NOT EXISTS commentlikes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        comment_id INTEGER,
+        user_id INTEGER,
+        is_like INTEGER,
+        FOREIGN KEY(comment_id) REFERENCES comments(id),
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+    CREATE TABLE IF NOT EXISTS categories (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT UNIQUE NOT NULL
+    );
+    INSERT INTO categories (name) VALUES ('General'), ('Technology'), ('Art');
+    INSERT INTO users (email, username, password) VALUES ('a@example.com', 'alice', 'x');
+    INSERT INTO posts (user_id, title, content, Author, Category)
+        VALUES (1, 'first', 'hello', 'alice', 'General,Art'),
+               (1, 'second', 'world', 'alice', 'Technology');
+    -- Double clicks used to store duplicate reactions; the last one counts.
+    INSERT INTO likes (post_id, user_id, is_like) VALUES (1, 1, 1), (1, 1, 1), (1, 1, -1), (2, 1, 1);
+`
+
+func openMemoryDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every connection to :memory: is a separate database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func assertFullyMigrated(t *testing.T, db *sql.DB) {
+	t.Helper()
+	applied, err := AppliedVersions(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range All {
+		if !applied[m.Version] {
+			t.Errorf("migration %d (%s) not recorded", m.Version, m.Name)
+		}
+	}
+
+	// Running again must be a no-op.
+	n, err := Apply(db)
+	if err != nil {
+		t.Fatalf("second Apply: %v", err)
+	}
+	if n != 0 {
+		t.Errorf("second Apply applied %d migrations, want 0", n)
+	}
+}
+
+func TestApplyEmptyDatabase(t *testing.T) {
+	db := openMemoryDB(t)
+
+	n, err := Apply(db)
+	if err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	if n != len(All) {
+		t.Errorf("applied %d migrations, want %d", n, len(All))
+	}
+	assertFullyMigrated(t, db)
+}
+
+func TestApplyLegacyDatabase(t *testing.T) {
+	db := openMemoryDB(t)
+	if _, err := db.Exec(legacySchema); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Apply(db); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+	assertFullyMigrated(t, db)
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 {
+		t.Errorf("users = %d, want 1", count)
+	}
+
+	want := map[int]int{1: 2, 2: 1}
+	for postID, wantCount := range want {
+		if err := db.QueryRow("SELECT COUNT(*) FROM post_categories WHERE post_id = ?", postID).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != wantCount {
+			t.Errorf("post %d has %d categories, want %d", postID, count, wantCount)
+		}
+	}
+	rows, err := db.Query("SELECT target, target_id, user_id, type FROM reactions ORDER BY target_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reactions []string
+	for rows.Next() {
+		var target, kind string
+		var targetID, userID int
+		if err := rows.Scan(&target, &targetID, &userID, &kind); err != nil {
+			t.Fatal(err)
+		}
+		reactions = append(reactions, fmt.Sprintf("%s %d by %d: %s", target, targetID, userID, kind))
+	}
+	rows.Close()
+	wantReactions := []string{"post 1 by 1: dislike", "post 2 by 1: like"}
+	if fmt.Sprint(reactions) != fmt.Sprint(wantReactions) {
+		t.Errorf("reactions after migration = %q, want %q", reactions, wantReactions)
+	}
+	for postID, wantScore := range map[int]int{1: -1, 2: 1} {
+		var score int
+		if err := db.QueryRow("SELECT score FROM posts WHERE id = ?", postID).Scan(&score); err != nil {
+			t.Fatal(err)
+		}
+		if score != wantScore {
+			t.Errorf("post %d score = %d, want %d", postID, score, wantScore)
+		}
+	}
+	if _, err := db.Exec("INSERT INTO reactions (target, target_id, user_id, type) VALUES ('post', 1, 1, 'love')"); err == nil {
+		t.Error("duplicate reaction inserted despite the unique index")
+	}
+}
+
+func TestApplyRejectsOutOfOrder(t *testing.T) {
+	db := openMemoryDB(t)
+	bad := []Migration{
+		{Version: 2, Name: "two", Up: "SELECT 1"},
+		{Version: 1, Name: "one", Up: "SELECT 1"},
+	}
+	if _, err := apply(db, bad); err == nil {
+		t.Fatal("expected an error for out of order migrations")
+	}
+}
@@ -0,0 +1,358 @@
+package migrations
+
+// All lists every migration in version order. Never edit a migration that has
+// shipped; add a new one at the end instead.
+var All = []Migration{
+	{
+		Version: 1,
+		Name:    "initial schema",
+		Up: `
+    CREATE TABLE IF NOT EXISTS users (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        email TEXT UNIQUE NOT NULL,
+        username TEXT UNIQUE NOT NULL,
+        password TEXT NOT NULL
+    );
+
+    CREATE TABLE IF NOT EXISTS posts (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER,
+        title TEXT NOT NULL,
+        content TEXT NOT NULL,
+        Author Text NOT NULL,
+        Category TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+
+    CREATE TABLE IF NOT EXISTS comments (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        post_id INTEGER,
+        user_id INTEGER,
+        Author Text NOT NULL,
+        comment TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(post_id) REFERENCES posts(id),
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+
+    CREATE TABLE IF NOT EXISTS likes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        post_id INTEGER,
+        user_id INTEGER,
+        is_like INTEGER,
+        FOREIGN KEY(post_id) REFERENCES posts(id),
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+
+    CREATE TABLE IF NOT EXISTS commentlikes (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        comment_id INTEGER,
+        user_id INTEGER,
+        is_like INTEGER,
+        FOREIGN KEY(comment_id) REFERENCES comments(id),
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+
+    CREATE TABLE IF NOT EXISTS categories (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        name TEXT UNIQUE NOT NULL
+    );`,
+	},
+	{
+		Version: 2,
+		Name:    "sessions",
+		Up: `
+    CREATE TABLE IF NOT EXISTS sessions (
+        id TEXT PRIMARY KEY,
+        user_id INTEGER NOT NULL,
+        user_agent TEXT NOT NULL DEFAULT '',
+        ip TEXT NOT NULL DEFAULT '',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        last_seen DATETIME DEFAULT CURRENT_TIMESTAMP,
+        expires_at DATETIME NOT NULL,
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );`,
+	},
+	{
+		Version: 3,
+		Name:    "post categories join table",
+		// Splits the comma separated names in the legacy posts.Category
+		// column into post_categories rows.
+		Up: `
+    CREATE TABLE IF NOT EXISTS post_categories (
+        post_id INTEGER NOT NULL,
+        category_id INTEGER NOT NULL,
+        PRIMARY KEY(post_id, category_id),
+        FOREIGN KEY(post_id) REFERENCES posts(id),
+        FOREIGN KEY(category_id) REFERENCES categories(id)
+    );
+
+    WITH RECURSIVE split(post_id, name, rest) AS (
+        SELECT id, '', Category || ',' FROM posts WHERE Category != ''
+        UNION ALL
+        SELECT post_id, trim(substr(rest, 1, instr(rest, ',') - 1)), substr(rest, instr(rest, ',') + 1)
+        FROM split WHERE rest != ''
+    )
+    INSERT OR IGNORE INTO post_categories (post_id, category_id)
+    SELECT s.post_id, c.id FROM split s JOIN categories c ON c.name = s.name;`,
+	},
+	{
+		Version: 4,
+		Name:    "post edit timestamp",
+		Up: `
+    ALTER TABLE posts ADD COLUMN updated_at DATETIME;`,
+	},
+	{
+		Version: 5,
+		Name:    "comment edit and delete timestamps",
+		// A deleted comment keeps its row, with deleted_at set, so replies
+		// and counts around it don't shift.
+		Up: `
+    ALTER TABLE comments ADD COLUMN updated_at DATETIME;
+    ALTER TABLE comments ADD COLUMN deleted_at DATETIME;`,
+	},
+	{
+		Version: 6,
+		Name:    "comment replies",
+		Up: `
+    ALTER TABLE comments ADD COLUMN parent_id INTEGER REFERENCES comments(id);
+    CREATE INDEX IF NOT EXISTS comments_post_parent ON comments(post_id, parent_id);`,
+	},
+	{
+		Version: 7,
+		Name:    "full-text search",
+		// One row per post and per live comment. Posts use rowid 2*id and
+		// comments 2*id+1, so the triggers can find their row directly.
+		Up: `
+    CREATE VIRTUAL TABLE IF NOT EXISTS search_index USING fts5(
+        title,
+        body,
+        author UNINDEXED,
+        kind UNINDEXED,
+        post_id UNINDEXED,
+        tokenize = 'porter unicode61'
+    );
+
+    INSERT INTO search_index (rowid, title, body, author, kind, post_id)
+        SELECT id * 2, title, content, Author, 'post', id FROM posts;
+    INSERT INTO search_index (rowid, title, body, author, kind, post_id)
+        SELECT id * 2 + 1, '', comment, Author, 'comment', post_id FROM comments WHERE deleted_at IS NULL;
+
+    CREATE TRIGGER IF NOT EXISTS posts_search_insert AFTER INSERT ON posts BEGIN
+        INSERT INTO search_index (rowid, title, body, author, kind, post_id)
+            VALUES (new.id * 2, new.title, new.content, new.Author, 'post', new.id);
+    END;
+    CREATE TRIGGER IF NOT EXISTS posts_search_update AFTER UPDATE OF title, content ON posts BEGIN
+        DELETE FROM search_index WHERE rowid = old.id * 2;
+        INSERT INTO search_index (rowid, title, body, author, kind, post_id)
+            VALUES (new.id * 2, new.title, new.content, new.Author, 'post', new.id);
+    END;
+    CREATE TRIGGER IF NOT EXISTS posts_search_delete AFTER DELETE ON posts BEGIN
+        DELETE FROM search_index WHERE rowid = old.id * 2;
+    END;
+
+    CREATE TRIGGER IF NOT EXISTS comments_search_insert AFTER INSERT ON comments WHEN new.deleted_at IS NULL BEGIN
+        INSERT INTO search_index (rowid, title, body, author, kind, post_id)
+            VALUES (new.id * 2 + 1, '', new.comment, new.Author, 'comment', new.post_id);
+    END;
+    CREATE TRIGGER IF NOT EXISTS comments_search_update AFTER UPDATE OF comment, deleted_at ON comments BEGIN
+        DELETE FROM search_index WHERE rowid = old.id * 2 + 1;
+        INSERT INTO search_index (rowid, title, body, author, kind, post_id)
+            SELECT new.id * 2 + 1, '', new.comment, new.Author, 'comment', new.post_id WHERE new.deleted_at IS NULL;
+    END;
+    CREATE TRIGGER IF NOT EXISTS comments_search_delete AFTER DELETE ON comments BEGIN
+        DELETE FROM search_index WHERE rowid = old.id * 2 + 1;
+    END;`,
+	},
+	{
+		Version: 8,
+		Name:    "personal access tokens",
+		// Only the SHA-256 of a token is stored; the token itself is shown
+		// to its owner once.
+		Up: `
+    CREATE TABLE IF NOT EXISTS api_tokens (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        name TEXT NOT NULL,
+        token_hash TEXT UNIQUE NOT NULL,
+        scope TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        last_used_at DATETIME,
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+    CREATE INDEX IF NOT EXISTS api_tokens_user ON api_tokens(user_id);`,
+	},
+	{
+		Version: 9,
+		Name:    "reaction scores",
+		// score is likes minus dislikes, kept up to date by the models in the
+		// same transaction as the reaction, so listings can sort on it.
+		Up: `
+    ALTER TABLE posts ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+    ALTER TABLE comments ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+    UPDATE posts SET score = COALESCE((SELECT SUM(is_like) FROM likes WHERE likes.post_id = posts.id), 0);
+    UPDATE comments SET score = COALESCE((SELECT SUM(is_like) FROM commentlikes WHERE commentlikes.comment_id = comments.id), 0)
+        WHERE deleted_at IS NULL;
+    CREATE INDEX IF NOT EXISTS posts_score ON posts(score, id);
+    CREATE INDEX IF NOT EXISTS likes_post ON likes(post_id);
+    CREATE INDEX IF NOT EXISTS commentlikes_comment ON commentlikes(comment_id);`,
+	},
+	{
+		Version: 10,
+		Name:    "unique reactions",
+		// A user has at most one reaction per post or comment. Duplicates
+		// from double clicks keep the newest row, and the scores are
+		// recomputed without them.
+		Up: `
+    DELETE FROM likes WHERE id NOT IN (SELECT MAX(id) FROM likes GROUP BY post_id, user_id);
+    DELETE FROM commentlikes WHERE id NOT IN (SELECT MAX(id) FROM commentlikes GROUP BY comment_id, user_id);
+    DROP INDEX IF EXISTS likes_post;
+    DROP INDEX IF EXISTS commentlikes_comment;
+    CREATE UNIQUE INDEX IF NOT EXISTS likes_post_user ON likes(post_id, user_id);
+    CREATE UNIQUE INDEX IF NOT EXISTS commentlikes_comment_user ON commentlikes(comment_id, user_id);
+    UPDATE posts SET score = COALESCE((SELECT SUM(is_like) FROM likes WHERE likes.post_id = posts.id), 0);
+    UPDATE comments SET score = COALESCE((SELECT SUM(is_like) FROM commentlikes WHERE commentlikes.comment_id = comments.id), 0)
+        WHERE deleted_at IS NULL;`,
+	},
+	{
+		Version: 11,
+		Name:    "emoji reactions",
+		// One table for every kind of reaction to posts and comments. A user
+		// has at most one reaction per target. Existing likes and dislikes
+		// become the "like" and "dislike" reactions.
+		Up: `
+    CREATE TABLE IF NOT EXISTS reactions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        target TEXT NOT NULL CHECK (target IN ('post', 'comment')),
+        target_id INTEGER NOT NULL,
+        user_id INTEGER NOT NULL,
+        type TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE (target, target_id, user_id),
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+    CREATE INDEX IF NOT EXISTS reactions_target_type ON reactions(target, target_id, type);
+    INSERT INTO reactions (target, target_id, user_id, type)
+        SELECT 'post', post_id, user_id, CASE is_like WHEN 1 THEN 'like' ELSE 'dislike' END
+        FROM likes WHERE is_like IN (1, -1) ORDER BY id;
+    INSERT INTO reactions (target, target_id, user_id, type)
+        SELECT 'comment', comment_id, user_id, CASE is_like WHEN 1 THEN 'like' ELSE 'dislike' END
+        FROM commentlikes WHERE is_like IN (1, -1) ORDER BY id;
+    DROP TABLE likes;
+    DROP TABLE commentlikes;`,
+	},
+	{
+		Version: 12,
+		Name:    "moderation",
+		// Roles live on users. Hidden posts and comments stay in the database
+		// for moderators; locked posts take no new comments. mod_actions is
+		// the audit log; actor_id is NULL for actions taken from the command
+		// line or by the forum itself.
+		Up: `
+    ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'moderator', 'admin'));
+    ALTER TABLE posts ADD COLUMN hidden_at DATETIME;
+    ALTER TABLE posts ADD COLUMN locked_at DATETIME;
+    ALTER TABLE comments ADD COLUMN hidden_at DATETIME;
+    CREATE TABLE IF NOT EXISTS mod_actions (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        actor_id INTEGER,
+        action TEXT NOT NULL,
+        target TEXT NOT NULL,
+        target_id INTEGER NOT NULL,
+        reason TEXT NOT NULL,
+        details TEXT NOT NULL DEFAULT '',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(actor_id) REFERENCES users(id)
+    );
+    CREATE INDEX IF NOT EXISTS mod_actions_target ON mod_actions(target, target_id);`,
+	},
+	{
+		Version: 13,
+		Name:    "reports and notifications",
+		// A report stays open until a moderator resolves or dismisses it.
+		// Each user reports a post or comment at most once while earlier
+		// reports are open. Notifications tell reporters the outcome.
+		Up: `
+    CREATE TABLE IF NOT EXISTS reports (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        target TEXT NOT NULL CHECK (target IN ('post', 'comment')),
+        target_id INTEGER NOT NULL,
+        reporter_id INTEGER NOT NULL,
+        reason TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        resolved_at DATETIME,
+        resolution TEXT CHECK (resolution IN ('resolved', 'dismissed')),
+        resolver_id INTEGER,
+        FOREIGN KEY(reporter_id) REFERENCES users(id),
+        FOREIGN KEY(resolver_id) REFERENCES users(id)
+    );
+    CREATE UNIQUE INDEX IF NOT EXISTS reports_open ON reports(target, target_id, reporter_id) WHERE resolved_at IS NULL;
+    CREATE TABLE IF NOT EXISTS notifications (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER NOT NULL,
+        message TEXT NOT NULL,
+        link TEXT NOT NULL DEFAULT '',
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        read_at DATETIME,
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+    CREATE INDEX IF NOT EXISTS notifications_user ON notifications(user_id, id);`,
+	},
+	{
+		Version: 14,
+		Name:    "login failures",
+		// Every failed login is kept until the account next logs in, so the
+		// owner can be told about them. user_id is NULL when the login named
+		// no account; those rows only count against the IP address.
+		Up: `
+    ALTER TABLE users ADD COLUMN locked_until DATETIME;
+    CREATE TABLE IF NOT EXISTS login_failures (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user_id INTEGER,
+        ip TEXT NOT NULL,
+        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(user_id) REFERENCES users(id)
+    );
+    CREATE INDEX IF NOT EXISTS login_failures_user ON login_failures(user_id, created_at);
+    CREATE INDEX IF NOT EXISTS login_failures_ip ON login_failures(ip, created_at);`,
+	},
+	{
+		Version: 15,
+		Name:    "email verification",
+		// Users registered before verification existed start unverified.
+		Up: `
+    ALTER TABLE users ADD COLUMN email_verified_at DATETIME;`,
+	},
+	{
+		Version: 16,
+		Name:    "strip search highlight markers",
+		// Text is now stored without control characters. Older posts and
+		// comments could hold the characters search snippets use to mark
+		// matches; the update triggers reindex the rows changed here.
+		Up: `
+    UPDATE posts SET title = replace(replace(title, char(2), ''), char(3), ''),
+        content = replace(replace(content, char(2), ''), char(3), '')
+        WHERE instr(title || content, char(2)) > 0 OR instr(title || content, char(3)) > 0;
+    UPDATE comments SET comment = replace(replace(comment, char(2), ''), char(3), '')
+        WHERE instr(comment, char(2)) > 0 OR instr(comment, char(3)) > 0;`,
+	},
+	{
+		Version: 17,
+		Name:    "hash session ids",
+		// Sessions are now stored under the SHA-256 of their ID, which
+		// SQLite can't compute, so the plain text ones end and everybody
+		// logs in once more.
+		Up: `
+    DELETE FROM sessions;`,
+	},
+	{
+		Version: 18,
+		Name:    "pruned login failures",
+		// Failures older than the lockout are deleted for every account;
+		// this keeps count of them until the owner logs in and hears about
+		// them.
+		Up: `
+    ALTER TABLE users ADD COLUMN pruned_login_failures INTEGER NOT NULL DEFAULT 0;`,
+	},
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// VerifyEmail marks email as verified for a user, provided it is still the
+// user's address. Verifying twice keeps the first time.
+func VerifyEmail(userID int, email string) error {
+	res, err := db.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ? AND email = ?",
+		sqlTime(time.Now()), userID, email)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// SetPassword stores a new password hash for a user. Like UnlockUser, it
+// lifts a lock from failed logins and restarts their count.
+func SetPassword(userID int, hash string) error {
+	res, err := db.Exec("UPDATE users SET password = ?, locked_until = ? WHERE id = ?", hash, sqlTime(time.Now()), userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -1,10 +1,12 @@
 package models
 
 import (
+	"Forum/migrations"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -12,14 +14,20 @@ import (
 )
 
 var ErrUserExists = errors.New("user already exists")
+var ErrPostNotFound = errors.New("post not found")
+var ErrNotPostAuthor = errors.New("post belongs to another user")
+var ErrCommentNotFound = errors.New("comment not found")
+var ErrNotCommentAuthor = errors.New("comment belongs to another user")
 var db *sql.DB
 
 // User structure
 type User struct {
-	ID       int
-	Email    string
-	Username string
-	Password string
+	ID            int
+	Email         string
+	Username      string
+	Password      string
+	Role          string // one of the Role* constants
+	EmailVerified bool
 }
 
 // Post structure
@@ -32,37 +40,47 @@ type Post struct {
 	Category   []Category
     Likes      int
     Dislikes   int
+	Score      int // likes minus dislikes
+	Hidden     bool // hidden by a moderator
+	Locked     bool // locked by a moderator against new comments
 	Created_at string
+	Updated_at string // empty until the post is edited
 }
 
 // Comment structure
 type Comment struct {
 	ID         int
+	PostID     int
+	ParentID   int // 0 for comments on the post itself
 	Content    string
 	User_ID    string
 	Author     string
 	Created_at string
+	Updated_at string // empty until the comment is edited
+	Deleted_at string // set once the comment is deleted; Content and Author are blank then
+	Hidden     bool   // hidden by a moderator
+	Replies    []Comment // filled in by GetCommentTree
 }
 type Category struct {
 	ID   int
 	Name string
 }
-type Like struct {
-	ID     int
-	PostID string
-	UserID string
-	IsLike string
-}
-type CommentLike struct {
-	ID     int
-	CommentID string
-	UserID string
-	IsLike string
+// Session is one logged in device of a user
+type Session struct {
+	ID        string
+	Key       string // SessionKey(ID); lists of sessions carry only the key
+	UserID    int
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	LastSeen  time.Time
+	ExpiresAt time.Time
 }
+
 // Initialize the database connection
-func InitDB() {
+func InitDB(dsn string) {
 	var err error
-	db, err = sql.Open("sqlite", "./forum.db")
+	db, err = sql.Open("sqlite", withBusyTimeout(dsn))
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -72,72 +90,31 @@ func InitDB() {
 		log.Fatal(err)
 	}
 
-	// Create necessary tables
-	CreateTables()
+	// Bring the schema up to date
+	if _, err := migrations.Apply(db); err != nil {
+		log.Fatalf("Error migrating database: %s", err)
+	}
 	CreateCategory(db)
-	log.Println("Database connected and tables created successfully")
-}
-
-// Create database tables
-func CreateTables() {
-	query := `
-    CREATE TABLE IF NOT EXISTS users (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        email TEXT UNIQUE NOT NULL,
-        username TEXT UNIQUE NOT NULL,
-        password TEXT NOT NULL
-    );
-
-    CREATE TABLE IF NOT EXISTS posts (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        user_id INTEGER,
-        title TEXT NOT NULL,
-        content TEXT NOT NULL,
-        Author Text NOT NULL,
-        Category TEXT NOT NULL,
-        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-        FOREIGN KEY(user_id) REFERENCES users(id)
-    );
-
-    CREATE TABLE IF NOT EXISTS comments (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        post_id INTEGER,
-        user_id INTEGER,
-        Author Text NOT NULL,
-        comment TEXT NOT NULL,
-        created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-        FOREIGN KEY(post_id) REFERENCES posts(id),
-        FOREIGN KEY(user_id) REFERENCES users(id)
-    );
-
-    CREATE TABLE IF NOT EXISTS likes (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        post_id INTEGER,
-        user_id INTEGER,
-        is_like INTEGER,
-        FOREIGN KEY(post_id) REFERENCES posts(id),
-        FOREIGN KEY(user_id) REFERENCES users(id)
-    );
-	CREATE TABLE IF NOT EXISTS commentlikes (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        comment_id INTEGER,
-        user_id INTEGER,
-        is_like INTEGER,
-        FOREIGN KEY(comment_id) REFERENCES comments(id),
-        FOREIGN KEY(user_id) REFERENCES users(id)
-    );
-	
-    CREATE TABLE IF NOT EXISTS categories (
-        id INTEGER PRIMARY KEY AUTOINCREMENT,
-        name TEXT UNIQUE NOT NULL
-    );
-    
-    `
-
-	_, err := db.Exec(query)
-	if err != nil {
-		log.Fatalf("Error creating tables: %s", err)
+	log.Println("Database connected and migrations applied successfully")
+}
+
+// withBusyTimeout makes connections wait up to five seconds for another
+// connection's write to finish instead of failing with SQLITE_BUSY, unless
+// the DSN sets its own busy_timeout.
+func withBusyTimeout(dsn string) string {
+	if strings.Contains(dsn, "busy_timeout") {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
 	}
+	return dsn + sep + "_pragma=busy_timeout(5000)"
+}
+
+// CloseDB closes the database handle once the server is done with it
+func CloseDB() error {
+	return db.Close()
 }
 
 // Create user
@@ -171,8 +148,17 @@ func CreateUser(user User) error {
 // Get user by email
 func GetUserByEmail(email string) (*User, error) {
 	var user User
-	err := db.QueryRow("SELECT id, email, username, password FROM users WHERE email = ?", email).
-		Scan(&user.ID, &user.Email, &user.Username, &user.Password)
+	err := db.QueryRow("SELECT id, email, username, password, role, email_verified_at IS NOT NULL FROM users WHERE email = ?", email).
+		Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.EmailVerified)
+	if err != nil {
+		return nil, errors.New("user not found")
+	}
+	return &user, nil
+}
+func GetUserByID(userID int) (*User, error) {
+	var user User
+	err := db.QueryRow("SELECT id, email, username, password, role, email_verified_at IS NOT NULL FROM users WHERE id = ?", userID).
+		Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.EmailVerified)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
@@ -180,112 +166,369 @@ func GetUserByEmail(email string) (*User, error) {
 }
 func GetUserByUserName(username string) (*User, error) {
 	var user User
-	err := db.QueryRow("SELECT id, email, username, password FROM users WHERE username = ?", username).
-		Scan(&user.ID, &user.Email, &user.Username, &user.Password)
+	err := db.QueryRow("SELECT id, email, username, password, role, email_verified_at IS NOT NULL FROM users WHERE username = ?", username).
+		Scan(&user.ID, &user.Email, &user.Username, &user.Password, &user.Role, &user.EmailVerified)
 	if err != nil {
 		return nil, errors.New("user not found")
 	}
 	return &user, nil
 }
 
-// Get all posts
-func GetAllPosts() ([]Post, error) {
-	var posts []Post
-	rows, err := db.Query("SELECT  id ,user_id, title, content ,Author , created_at   FROM posts")
+// Get post by ID
+func GetPostByID(postID string) (*Post, error) {
+	var post Post
+	var createdAt time.Time
+	var updatedAt sql.NullTime
+	err := db.QueryRow(`SELECT id ,user_id, title, content ,Author , created_at, updated_at, score,
+		hidden_at IS NOT NULL, locked_at IS NOT NULL FROM posts WHERE id = ?`, postID).
+		Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.Author, &createdAt, &updatedAt, &post.Score, &post.Hidden, &post.Locked)
+	if err != nil {
+		return nil, ErrPostNotFound
+	}
+	post.Created_at = createdAt.Format("2006-01-02 15:04:05")
+	if updatedAt.Valid {
+		post.Updated_at = updatedAt.Time.Format("2006-01-02 15:04:05")
+	}
+	post.Category, err = GetPostCategories(post.ID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return &post, nil
+}
 
-	for rows.Next() {
-		var post Post
-		var createdAt time.Time
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.Author, &createdAt); err != nil {
-			return nil, err
+// Create post
+// The legacy posts.Category column is left empty; categories live in post_categories.
+// It returns the ID of the new post, or a ValidationError for bad input.
+func CreatePost(userID int, title, content string, categoryIDs []int) (int, error) {
+	title, content = cleanText(title), cleanText(content)
+	if err := ValidatePost(title, content, categoryIDs); err != nil {
+		return 0, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO posts (user_id, title, content ,Author, Category) SELECT id, ?, ?, username, '' FROM users WHERE id = ?", title, content, userID)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, errors.New("user not found")
+	}
+	postID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := setPostCategories(tx, int(postID), categoryIDs); err != nil {
+		return 0, err
+	}
+	return int(postID), tx.Commit()
+}
+
+// checkPostAuthor returns ErrPostNotFound or ErrNotPostAuthor unless the post
+// exists and was written by userID.
+func checkPostAuthor(tx *sql.Tx, postID, userID int) error {
+	var authorID int
+	err := tx.QueryRow("SELECT user_id FROM posts WHERE id = ?", postID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return ErrPostNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if authorID != userID {
+		return ErrNotPostAuthor
+	}
+	return nil
+}
+
+// UpdatePost changes the title, content and categories of a post written by
+// userID and records when it was edited.
+func UpdatePost(postID, userID int, title, content string, categoryIDs []int) error {
+	title, content = cleanText(title), cleanText(content)
+	if err := ValidatePost(title, content, categoryIDs); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkPostAuthor(tx, postID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE posts SET title = ?, content = ?, updated_at = ? WHERE id = ?",
+		title, content, sqlTime(time.Now()), postID); err != nil {
+		return err
+	}
+	if err := setPostCategories(tx, postID, categoryIDs); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// setPostCategories replaces the categories of a post. It returns a
+// ValidationError unless categoryIDs are all existing categories.
+func setPostCategories(tx *sql.Tx, postID int, categoryIDs []int) error {
+	if len(categoryIDs) == 0 {
+		return ValidationError{"categories": "Pick at least one category"}
+	}
+	for _, categoryID := range categoryIDs {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM categories WHERE id = ?)", categoryID).Scan(&exists); err != nil {
+			return err
+		}
+		if !exists {
+			return ValidationError{"categories": fmt.Sprintf("Unknown category %d", categoryID)}
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM post_categories WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	for _, categoryID := range categoryIDs {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO post_categories (post_id, category_id) VALUES (?, ?)", postID, categoryID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeletePost removes a post written by userID together with its comments,
+// reactions and categories.
+func DeletePost(postID, userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkPostAuthor(tx, postID, userID); err != nil {
+		return err
+	}
+	if err := deletePost(tx, postID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deletePost removes a post and everything attached to it.
+func deletePost(tx *sql.Tx, postID int) error {
+	statements := []string{
+		"DELETE FROM reactions WHERE target = 'comment' AND target_id IN (SELECT id FROM comments WHERE post_id = ?)",
+		"DELETE FROM comments WHERE post_id = ?",
+		"DELETE FROM reactions WHERE target = 'post' AND target_id = ?",
+		"DELETE FROM post_categories WHERE post_id = ?",
+		"DELETE FROM posts WHERE id = ?",
+	}
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, postID); err != nil {
+			return err
 		}
-		post.Created_at = createdAt.Format("2006-01-02 15:04:05")
-		posts = append(posts, post)
 	}
-	return posts, nil
+	return nil
 }
 
-func GetAllCategoryPosts(isCategory string) ([]Post, error) {
-	var posts []Post
-	query := "SELECT id, user_id, title, content, Author , created_at FROM posts WHERE Category LIKE ?"
-	// Prepare the LIKE pattern to search for the category
-	pattern := "%" + isCategory + "%"
+// CreateComment adds a comment to a post. A parentID other than 0 makes it a
+// reply to another live comment on the same post. Locked posts take no new
+// comments. It returns the ID of the new comment, or a ValidationError for
+// bad input.
+func CreateComment(userID int, postID, comment string, parentID int) (int, error) {
+	comment = cleanText(comment)
+	if err := ValidateComment(comment); err != nil {
+		return 0, err
+	}
+	var hidden, locked bool
+	err := db.QueryRow("SELECT hidden_at IS NOT NULL, locked_at IS NOT NULL FROM posts WHERE id = ?", postID).Scan(&hidden, &locked)
+	if err == sql.ErrNoRows || hidden {
+		return 0, ErrPostNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if locked {
+		return 0, ErrPostLocked
+	}
+
+	var parent interface{}
+	if parentID != 0 {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM comments WHERE id = ? AND post_id = ? AND deleted_at IS NULL)", parentID, postID).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, ErrCommentNotFound
+		}
+		parent = parentID
+	}
 
-	rows, err := db.Query(query, pattern)
+	res, err := db.Exec("INSERT INTO comments (post_id , user_id, Author , comment, parent_id) SELECT ?, id, username, ?, ? FROM users WHERE id = ?", postID, comment, parent, userID)
+	if err != nil {
+		return 0, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, errors.New("user not found")
+	}
+	commentID, err := res.LastInsertId()
+	return int(commentID), err
+}
+
+// Get comments by post ID
+// Deleted comments are kept as tombstones so the thread keeps its shape.
+func GetCommentsByPostID(postID string) ([]Comment, error) {
+	var comments []Comment
+	rows, err := db.Query("SELECT id, post_id, parent_id, user_id, Author ,comment , created_at, updated_at, deleted_at, hidden_at IS NOT NULL FROM comments WHERE post_id = ? ORDER BY id", postID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var post Post
-		var createdAt time.Time
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.Author, &createdAt); err != nil {
+		comment, err := scanComment(rows)
+		if err != nil {
 			return nil, err
 		}
-		post.Created_at = createdAt.Format("2006-01-02 15:04:05")
-		posts = append(posts, post)
+		comments = append(comments, *comment)
+	}
+	return comments, rows.Err()
+}
+
+// GetCommentTree returns the comments of a post as a tree: top-level comments
+// with their replies nested in Replies, oldest first. Replies nested deeper
+// than maxDepth levels are listed flat at the last allowed level, right after
+// the comment they answer, so nothing gets lost. A maxDepth below 1 means no
+// limit.
+func GetCommentTree(postID string, maxDepth int) ([]Comment, error) {
+	comments, err := GetCommentsByPostID(postID)
+	if err != nil {
+		return nil, err
 	}
 
-	return posts, nil
+	known := make(map[int]bool, len(comments))
+	for _, comment := range comments {
+		known[comment.ID] = true
+	}
+	children := make(map[int][]Comment)
+	for _, comment := range comments {
+		parentID := comment.ParentID
+		if !known[parentID] {
+			parentID = 0 // orphaned replies show up as top-level comments
+		}
+		children[parentID] = append(children[parentID], comment)
+	}
+	return buildCommentTree(children, 0, 1, maxDepth), nil
 }
 
-// Get post by ID
-func GetPostByID(postID string) (*Post, error) {
-	var post Post
+// buildCommentTree returns the replies to parentID, which sit at the given
+// depth, with their own replies attached.
+func buildCommentTree(children map[int][]Comment, parentID, depth, maxDepth int) []Comment {
+	var tree []Comment
+	for _, comment := range children[parentID] {
+		if maxDepth > 0 && depth >= maxDepth {
+			// Too deep to nest any further: list the whole sub-thread here.
+			tree = append(tree, comment)
+			tree = append(tree, buildCommentTree(children, comment.ID, depth, maxDepth)...)
+			continue
+		}
+		comment.Replies = buildCommentTree(children, comment.ID, depth+1, maxDepth)
+		tree = append(tree, comment)
+	}
+	return tree
+}
+
+// GetCommentByID returns a single comment, which may be a tombstone.
+func GetCommentByID(commentID int) (*Comment, error) {
+	row := db.QueryRow("SELECT id, post_id, parent_id, user_id, Author ,comment , created_at, updated_at, deleted_at, hidden_at IS NOT NULL FROM comments WHERE id = ?", commentID)
+	comment, err := scanComment(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrCommentNotFound
+	}
+	return comment, err
+}
+
+// scanComment reads a comment row selected by GetCommentsByPostID or
+// GetCommentByID and blanks out deleted comments.
+func scanComment(row interface{ Scan(...interface{}) error }) (*Comment, error) {
+	var comment Comment
 	var createdAt time.Time
-	err := db.QueryRow("SELECT id ,user_id, title, content ,Author , created_at FROM posts WHERE id = ?", postID).
-		Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.Author, &createdAt)
-	if err != nil {
-		return nil, errors.New("post not found")
+	var parentID sql.NullInt64
+	var updatedAt, deletedAt sql.NullTime
+	if err := row.Scan(&comment.ID, &comment.PostID, &parentID, &comment.User_ID, &comment.Author, &comment.Content, &createdAt, &updatedAt, &deletedAt, &comment.Hidden); err != nil {
+		return nil, err
 	}
-	post.Created_at = createdAt.Format("2006-01-02 15:04:05")
-	return &post, nil
+	comment.ParentID = int(parentID.Int64)
+	comment.Created_at = createdAt.Format("2006-01-02 15:04:05")
+	if updatedAt.Valid {
+		comment.Updated_at = updatedAt.Time.Format("2006-01-02 15:04:05")
+	}
+	if deletedAt.Valid {
+		comment.Deleted_at = deletedAt.Time.Format("2006-01-02 15:04:05")
+		comment.Content = ""
+		comment.Author = ""
+	}
+	return &comment, nil
 }
 
-// Create post
-func CreatePost(userID, title, content, categories string) error {
-	stmt, err := db.Prepare("INSERT INTO posts (user_id, title, content ,Author, Category) VALUES(?, ?, ?,?,?)")
+// checkCommentAuthor returns ErrCommentNotFound or ErrNotCommentAuthor unless
+// the comment exists, is not deleted and was written by userID.
+func checkCommentAuthor(tx *sql.Tx, commentID, userID int) error {
+	var authorID int
+	err := tx.QueryRow("SELECT user_id FROM comments WHERE id = ? AND deleted_at IS NULL", commentID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return ErrCommentNotFound
+	}
 	if err != nil {
 		return err
 	}
-	user, _ := GetUserByUserName(userID)
-	_, err = stmt.Exec(user.ID, title, content, user.Username, categories)
-	return err
+	if authorID != userID {
+		return ErrNotCommentAuthor
+	}
+	return nil
 }
-func CreateComment(userID, postID, comment string) error {
-	stmt, err := db.Prepare("INSERT INTO comments (post_id , user_id, Author , comment) VALUES(?,?,?,?)")
+
+// UpdateComment replaces the text of a comment written by userID and records
+// when it was edited.
+func UpdateComment(commentID, userID int, content string) error {
+	content = cleanText(content)
+	if err := ValidateComment(content); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	user, _ := GetUserByUserName(userID)
-	_, err = stmt.Exec(postID, user.ID, user.Username, comment)
-	return err
+	defer tx.Rollback()
+
+	if err := checkCommentAuthor(tx, commentID, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE comments SET comment = ?, updated_at = ? WHERE id = ?",
+		content, sqlTime(time.Now()), commentID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Get comments by post ID
-func GetCommentsByPostID(postID string) ([]Comment, error) {
-	var comments []Comment
-	rows, err := db.Query("SELECT id, user_id, Author ,comment , created_at FROM comments WHERE post_id = ?", postID)
+// DeleteComment turns a comment written by userID into a tombstone. Its text
+// is erased but the row stays so the thread keeps its shape.
+func DeleteComment(commentID, userID int) error {
+	tx, err := db.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	for rows.Next() {
-		var comment Comment
-		var createdAt time.Time
-		if err := rows.Scan(&comment.ID, &comment.User_ID, &comment.Author, &comment.Content, &createdAt); err != nil {
-			return nil, err
-		}
-		comment.Created_at = createdAt.Format("2006-01-02 15:04:05")
-		comments = append(comments, comment)
+	if err := checkCommentAuthor(tx, commentID, userID); err != nil {
+		return err
 	}
-	return comments, nil
+	if _, err := tx.Exec("UPDATE comments SET comment = '', deleted_at = ?, score = 0 WHERE id = ?",
+		sqlTime(time.Now()), commentID); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 var ErrCategoryExists = errors.New("category already exists")
@@ -330,213 +573,73 @@ func GetAllCategories() ([]Category, error) {
 	return categories, nil
 }
 
-// GetPostsFromUserID retrieves posts created by the user with the given userID
-func GetPostsFromUserID(userID string) ([]Post, error) {
-	var posts []Post
-	user , _ := GetUserByUserName(userID)
-	rows, err := db.Query("SELECT id, user_id, title, content, Author , created_at FROM posts WHERE user_id = ?", user.ID)
+// GetCategoryByID retrieves a single category
+func GetCategoryByID(categoryID int) (*Category, error) {
+	var category Category
+	err := db.QueryRow("SELECT id, name FROM categories WHERE id = ?", categoryID).Scan(&category.ID, &category.Name)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("category not found")
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var post Post
-		var createdAt time.Time
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.Author, &createdAt); err != nil {
-			
-			return nil, err
-		}
-		post.Created_at = createdAt.Format("2006-01-02 15:04:05")
-		posts = append(posts, post)
-	}
-
-	return posts, nil
+	return &category, nil
 }
 
-
-
-func GetPostsFromLiked(userID string) ([]Post, error) {
-	var posts []Post
-	user , _ := GetUserByUserName(userID)
-
-	query := `
-		SELECT p.id, p.user_id, p.title, p.content, p.Author, p.created_at
-		FROM posts p
-		JOIN likes l ON p.id = l.post_id
-		WHERE l.user_id = ? AND l.is_like = 1
-	`
-
-	rows, err := db.Query(query, user.ID)
+// GetPostCategories retrieves the categories a post is filed under
+func GetPostCategories(postID int) ([]Category, error) {
+	rows, err := db.Query(`
+		SELECT c.id, c.name
+		FROM categories c
+		JOIN post_categories pc ON pc.category_id = c.id
+		WHERE pc.post_id = ?
+		ORDER BY c.id`, postID)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to fetch post categories: %w", err)
 	}
 	defer rows.Close()
 
+	var categories []Category
 	for rows.Next() {
-		var post Post
-		var createdAt time.Time
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.Author, &createdAt); err != nil {
-			
-			return nil, err
-		}
-		post.Created_at = createdAt.Format("2006-01-02 15:04:05")
-		posts = append(posts, post)
-	}
-
-	return posts, nil
-}
-func LikeCounter(postID string) (int ,error){
-	var likes []Like
-	rows, err := db.Query("SELECT is_like  FROM likes WHERE post_id = ? AND is_like = 1 ", postID)
-if err != nil {
-	return 0, errors.New(" not found")
-}
-defer rows.Close()
-
-	for rows.Next() {
-		var like Like
-		if err := rows.Scan(&like.IsLike); err != nil {
-			return 0, err
-		}
-		likes = append(likes, like)
-	}
-return len(likes), nil
-}
-func DisLikeCounter(postID string) (int ,error){
-	var likes []Like
-	rows, err := db.Query("SELECT is_like  FROM likes WHERE post_id = ? AND is_like = -1 ", postID)
-	if err != nil {
-		return 0, errors.New(" not found")
-	}
-	defer rows.Close()
-	
-		for rows.Next() {
-			var like Like
-			if err := rows.Scan(&like.IsLike); err != nil {
-				return 0, err
-			}
-			likes = append(likes, like)
+		var category Category
+		if err := rows.Scan(&category.ID, &category.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan category: %w", err)
 		}
-	return len(likes), nil
-}
-
-func AddLike(postID, userID, Liked string) {
-	stat, _ := db.Prepare("INSERT INTO likes (post_id,user_id, is_like) VALUES (?,?,?)")
-	user, _ := GetUserByUserName(userID)
-	stat.Exec(postID, user.ID, Liked)
-}
-func RemoveLike(postID, userID string) {
-	stat, _ := db.Prepare("DELETE FROM likes WHERE post_id = ? AND user_id = ?")
-	user, _ := GetUserByUserName(userID)
-	stat.Exec(postID, user.ID)
-}
-func UpdateLike(postID, userID, Liked string) {
-	statement, _ := db.Prepare("UPDATE likes SET is_like = ? WHERE post_id = ? AND user_id = ?")
-	user, _ := GetUserByUserName(userID)
-	statement.Exec(Liked, postID, user.ID)
-}
-
-func IsLike(postID, userID string) bool {
-	user, _ := GetUserByUserName(userID)
-
-	rows, _ := db.Query("SELECT is_like FROM likes WHERE user_id = ? AND post_id = ? AND is_like = 1", user.ID, postID)
-	like := 0
-	for rows.Next() {
-		rows.Scan(&like)
-	}
-	if like != 0 {
-		return true
+		categories = append(categories, category)
 	}
-	return false
+	return categories, nil
 }
-func IsDisLike(postID, userID string) bool {
-	user, _ := GetUserByUserName(userID)
 
-	rows, _ := db.Query("SELECT is_like FROM likes WHERE user_id = ? AND post_id = ? AND is_like = -1", user.ID, postID)
-	like := 0
-	for rows.Next() {
-		rows.Scan(&like)
+// attachCategories fills in Post.Category for every post with a single query
+func attachCategories(posts []Post) error {
+	if len(posts) == 0 {
+		return nil
 	}
-	if like != 0 {
-		return true
+	index := make(map[int]int, len(posts))
+	placeholders := make([]string, len(posts))
+	args := make([]interface{}, len(posts))
+	for i, post := range posts {
+		index[post.ID] = i
+		placeholders[i] = "?"
+		args[i] = post.ID
 	}
-	return false
-}
-func CommentLikeCounter(CommentID string) (int ,error){
-	var likes []CommentLike
-	rows, err := db.Query("SELECT is_like  FROM Commentlikes WHERE comment_id = ? AND is_like = 1 ", CommentID)
-if err != nil {
-	return 0, errors.New(" not found")
-}
-defer rows.Close()
 
-	for rows.Next() {
-		var like CommentLike
-		if err := rows.Scan(&like.IsLike); err != nil {
-			return 0, err
-		}
-		likes = append(likes, like)
-	}
-return len(likes), nil
-}
-func CommentDisLikeCounter(CommentID string) (int ,error){
-	var likes []CommentLike
-	rows, err := db.Query("SELECT is_like  FROM Commentlikes WHERE comment_id = ? AND is_like = -1 ", CommentID)
+	rows, err := db.Query(`
+		SELECT pc.post_id, c.id, c.name
+		FROM post_categories pc
+		JOIN categories c ON c.id = pc.category_id
+		WHERE pc.post_id IN (`+strings.Join(placeholders, ",")+`)
+		ORDER BY c.id`, args...)
 	if err != nil {
-		return 0, errors.New(" not found")
+		return fmt.Errorf("failed to fetch post categories: %w", err)
 	}
 	defer rows.Close()
-	
-		for rows.Next() {
-			var like CommentLike
-			if err := rows.Scan(&like.IsLike); err != nil {
-				return 0, err
-			}
-			likes = append(likes, like)
-		}
-	return len(likes), nil
-}
 
-func CommentAddLike(CommentID, userID, Liked string) {
-	stat, _ := db.Prepare("INSERT INTO Commentlikes (comment_id , user_id, is_like) VALUES (?,?,?)")
-	user, _ := GetUserByUserName(userID)
-	stat.Exec(CommentID, user.ID, Liked)
-}
-func CommentRemoveLike(CommentID, userID string) {
-	stat, _ := db.Prepare("DELETE FROM Commentlikes WHERE comment_id = ? AND user_id = ?")
-	user, _ := GetUserByUserName(userID)
-	stat.Exec(CommentID, user.ID)
-}
-func CommentUpdateLike(CommentID, userID, Liked string) {
-	statement, _ := db.Prepare("UPDATE Commentlikes SET is_like = ? WHERE comment_id = ? AND user_id = ?")
-	user, _ := GetUserByUserName(userID)
-	statement.Exec(Liked, CommentID, user.ID)
-}
-
-func CommentIsLike(CommentID, userID string) bool {
-	user, _ := GetUserByUserName(userID)
-
-	rows, _ := db.Query("SELECT is_like FROM Commentlikes WHERE user_id = ? AND comment_id = ? AND is_like = 1", user.ID, CommentID)
-	like := 0
 	for rows.Next() {
-		rows.Scan(&like)
-	}
-	if like != 0 {
-		return true
-	}
-	return false
-}
-func CommentIsDisLike(CommentID, userID string) bool {
-	user, _ := GetUserByUserName(userID)
-
-	rows, _ := db.Query("SELECT is_like FROM Commentlikes WHERE user_id = ? AND comment_id = ? AND is_like = -1", user.ID, CommentID)
-	like := 0
-	for rows.Next() {
-		rows.Scan(&like)
-	}
-	if like != 0 {
-		return true
+		var postID int
+		var category Category
+		if err := rows.Scan(&postID, &category.ID, &category.Name); err != nil {
+			return fmt.Errorf("failed to scan category: %w", err)
+		}
+		i := index[postID]
+		posts[i].Category = append(posts[i].Category, category)
 	}
-	return false
+	return rows.Err()
 }
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrAccountLocked = errors.New("account locked after too many failed logins")
+var ErrLoginThrottled = errors.New("too many failed logins, wait before trying again")
+
+// LoginLimits is the brute-force protection applied to logins.
+type LoginLimits struct {
+	MaxFailures   int           // failures in a row that lock an account; 0 turns account protection off
+	IPMaxFailures int           // failures from one IP address that block it; 0 never blocks
+	Lockout       time.Duration // how long a lock lasts, and how long a failure counts
+}
+
+// maxLoginDelay caps the wait between two failed logins on an account.
+const maxLoginDelay = time.Minute
+
+// loginDelay is how long an account waits after the nth failed login in a
+// row before the next try: 1s, 2s, 4s and so on.
+func loginDelay(n int) time.Duration {
+	if n <= 0 {
+		return 0
+	}
+	if n > 7 {
+		return maxLoginDelay
+	}
+	return min(time.Second<<(n-1), maxLoginDelay)
+}
+
+// LockedUser is an account locked by failed logins.
+type LockedUser struct {
+	ID          int
+	Username    string
+	LockedUntil time.Time
+}
+
+// BeginLogin checks whether a login of userID from ip may be tried now and,
+// if so, reserves it; userID is 0 when the login named no account. The
+// reservation is stored as a failed login in the same transaction as the
+// check, so logins tried at the same time count against each other and a
+// burst of guesses can't all pass before the first one fails.
+// RecordLoginSuccess takes the reservation back; RecordLoginFailure keeps
+// it. When the login may not be tried, nothing is stored and the error is
+// ErrAccountLocked or ErrLoginThrottled, with how long to wait.
+func BeginLogin(userID int, ip string, limits LoginLimits) (int64, time.Duration, error) {
+	now := time.Now()
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	// Writing first makes this a write transaction from the start. SQLite
+	// runs those one at a time, so the checks below see every other attempt.
+	var user interface{}
+	if userID != 0 {
+		user = userID
+	}
+	res, err := tx.Exec("INSERT INTO login_failures (user_id, ip, created_at) VALUES (?, ?, ?)", user, ip, sqlTime(now))
+	if err != nil {
+		return 0, 0, err
+	}
+	attempt, err := res.LastInsertId()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if limits.IPMaxFailures > 0 {
+		// The IP is blocked until its IPMaxFailures-th newest failure stops
+		// counting.
+		var nth time.Time
+		err := tx.QueryRow(`SELECT created_at FROM login_failures WHERE ip = ? AND created_at > ? AND id != ?
+			ORDER BY created_at DESC LIMIT 1 OFFSET ?`, ip, sqlTime(now.Add(-limits.Lockout)), attempt, limits.IPMaxFailures-1).Scan(&nth)
+		if err == nil {
+			return 0, nth.Add(limits.Lockout).Sub(now), ErrLoginThrottled
+		}
+		if err != sql.ErrNoRows {
+			return 0, 0, err
+		}
+	}
+	if userID != 0 && limits.MaxFailures > 0 {
+		until, err := lockedUntil(tx, userID)
+		if err != nil {
+			return 0, 0, err
+		}
+		if until.Valid && now.Before(until.Time) {
+			return 0, until.Time.Sub(now), ErrAccountLocked
+		}
+		streak, last, err := failureStreak(tx, userID, until, limits, now, attempt)
+		if err != nil {
+			return 0, 0, err
+		}
+		if wait := last.Add(loginDelay(streak)).Sub(now); streak > 0 && wait > 0 {
+			return 0, wait, ErrLoginThrottled
+		}
+	}
+	return attempt, 0, tx.Commit()
+}
+
+// RecordLoginFailure keeps the login BeginLogin reserved for userID, or for
+// no account when userID is 0, as a failure. It locks the account once the
+// failures in a row reach limits.MaxFailures and reports whether it did.
+func RecordLoginFailure(userID int, limits LoginLimits) (bool, error) {
+	now := time.Now()
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Neither the IP limit nor a streak counts failures older than the
+	// lockout, so drop them whatever account they named: otherwise guesses
+	// at accounts that never log in would pile up forever. Accounts keep
+	// count of theirs for the owner's next login.
+	expired := sqlTime(now.Add(-limits.Lockout))
+	if _, err := tx.Exec(`UPDATE users SET pruned_login_failures = pruned_login_failures +
+			(SELECT COUNT(*) FROM login_failures f WHERE f.user_id = users.id AND f.created_at <= ?)
+		WHERE id IN (SELECT user_id FROM login_failures WHERE created_at <= ?)`, expired, expired); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("DELETE FROM login_failures WHERE created_at <= ?", expired); err != nil {
+		return false, err
+	}
+
+	locked := false
+	if userID != 0 && limits.MaxFailures > 0 {
+		until, err := lockedUntil(tx, userID)
+		if err != nil {
+			return false, err
+		}
+		streak, _, err := failureStreak(tx, userID, until, limits, now, 0)
+		if err != nil {
+			return false, err
+		}
+		if streak >= limits.MaxFailures {
+			if _, err := tx.Exec("UPDATE users SET locked_until = ? WHERE id = ?", sqlTime(now.Add(limits.Lockout)), userID); err != nil {
+				return false, err
+			}
+			locked = true
+		}
+	}
+	return locked, tx.Commit()
+}
+
+// RecordLoginSuccess forgets the failed logins of a user who just logged in
+// with the login BeginLogin reserved as attempt. If there were any others,
+// the user gets a notification about them.
+func RecordLoginSuccess(userID int, attempt int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM login_failures WHERE id = ?", attempt); err != nil {
+		return err
+	}
+
+	var failures int
+	if err := tx.QueryRow(`SELECT pruned_login_failures + (SELECT COUNT(*) FROM login_failures WHERE user_id = users.id)
+		FROM users WHERE id = ?`, userID).Scan(&failures); err != nil {
+		return err
+	}
+	if failures == 0 {
+		return tx.Commit()
+	}
+	if _, err := tx.Exec("DELETE FROM login_failures WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE users SET locked_until = NULL, pruned_login_failures = 0 WHERE id = ?", userID); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("There were %d failed logins on your account since you last logged in. If that wasn't you, change your password.", failures)
+	if err := notify(tx, userID, message, "/account"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UnlockUser lifts the lock on an account and restarts its count of failed
+// logins. Only admins may. The failures stay, so the owner still hears about
+// them on the next login.
+func UnlockUser(actorID, userID int, reason string) error {
+	entry := ModAction{Action: ActionUnlockUser, Target: "user", TargetID: userID, Reason: reason}
+	return moderate(actorID, RoleAdmin, entry, func(tx *sql.Tx) (string, error) {
+		until, err := lockedUntil(tx, userID)
+		if err != nil {
+			return "", err
+		}
+		// Failures before locked_until no longer count towards a lock
+		if _, err := tx.Exec("UPDATE users SET locked_until = ? WHERE id = ?", sqlTime(time.Now()), userID); err != nil {
+			return "", err
+		}
+		if until.Valid && time.Now().Before(until.Time) {
+			return "was locked until " + sqlTime(until.Time) + " UTC", nil
+		}
+		return "", nil
+	})
+}
+
+// GetLockedUsers returns the accounts locked right now, the soonest unlocked
+// first.
+func GetLockedUsers() ([]LockedUser, error) {
+	rows, err := db.Query("SELECT id, username, locked_until FROM users WHERE locked_until > ? ORDER BY locked_until",
+		sqlTime(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []LockedUser
+	for rows.Next() {
+		var user LockedUser
+		if err := rows.Scan(&user.ID, &user.Username, &user.LockedUntil); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func lockedUntil(tx *sql.Tx, userID int) (sql.NullTime, error) {
+	var until sql.NullTime
+	err := tx.QueryRow("SELECT locked_until FROM users WHERE id = ?", userID).Scan(&until)
+	if err == sql.ErrNoRows {
+		return until, ErrUserNotFound
+	}
+	return until, err
+}
+
+// failureStreak counts the failed logins of a user that still count: those
+// newer than limits.Lockout and than the end of the last lock, leaving out
+// the one with ID exclude. It also returns when the newest of them happened.
+func failureStreak(tx *sql.Tx, userID int, lockedUntil sql.NullTime, limits LoginLimits, now time.Time, exclude int64) (int, time.Time, error) {
+	since := now.Add(-limits.Lockout)
+	if lockedUntil.Valid && lockedUntil.Time.After(since) {
+		since = lockedUntil.Time
+	}
+	var streak int
+	var last time.Time
+	rows, err := tx.Query("SELECT created_at FROM login_failures WHERE user_id = ? AND created_at > ? AND id != ? ORDER BY created_at DESC",
+		userID, sqlTime(since), exclude)
+	if err != nil {
+		return 0, last, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var at time.Time
+		if err := rows.Scan(&at); err != nil {
+			return 0, last, err
+		}
+		if streak == 0 {
+			last = at
+		}
+		streak++
+	}
+	return streak, last, rows.Err()
+}
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ageLoginFailures moves every failed login and lock back by d, as if d
+// passed.
+func ageLoginFailures(t *testing.T, d time.Duration) {
+	t.Helper()
+	modifier := "-" + strconv.Itoa(int(d.Seconds())) + " seconds"
+	for _, query := range []string{
+		"UPDATE login_failures SET created_at = datetime(created_at, ?)",
+		"UPDATE users SET locked_until = datetime(locked_until, ?) WHERE locked_until IS NOT NULL",
+	} {
+		if _, err := db.Exec(query, modifier); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// failLogin tries a login of userID from ip that fails, and reports whether
+// it locked the account.
+func failLogin(t *testing.T, userID int, ip string, limits LoginLimits) bool {
+	t.Helper()
+	if _, _, err := BeginLogin(userID, ip, limits); err != nil {
+		t.Fatalf("login refused: %v", err)
+	}
+	locked, err := RecordLoginFailure(userID, limits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return locked
+}
+
+// succeedLogin tries a login of userID from ip that succeeds.
+func succeedLogin(t *testing.T, userID int, ip string, limits LoginLimits) {
+	t.Helper()
+	attempt, _, err := BeginLogin(userID, ip, limits)
+	if err != nil {
+		t.Fatalf("login refused: %v", err)
+	}
+	if err := RecordLoginSuccess(userID, attempt); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "victim")
+	admin := createTestUser(t, "admin")
+	if err := SetUserRoleByName("admin", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	limits := LoginLimits{MaxFailures: 3, Lockout: 15 * time.Minute}
+	const ip = "192.0.2.1"
+
+	if failLogin(t, user, ip, limits) {
+		t.Fatal("first failure locked the account")
+	}
+	// Each failure makes the next try wait longer, and a refused try isn't
+	// stored
+	_, wait, err := BeginLogin(user, ip, limits)
+	if !errors.Is(err, ErrLoginThrottled) || wait > time.Second {
+		t.Errorf("right after a failure: wait %v, %v; want ErrLoginThrottled for at most 1s", wait, err)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM login_failures"); n != 1 {
+		t.Errorf("%d failures stored, want 1", n)
+	}
+	ageLoginFailures(t, 2*time.Second)
+	if failLogin(t, user, ip, limits) {
+		t.Fatal("second failure locked the account")
+	}
+	if _, wait, err := BeginLogin(user, ip, limits); !errors.Is(err, ErrLoginThrottled) || wait <= time.Second {
+		t.Errorf("after the second failure: wait %v, %v; want ErrLoginThrottled for up to 2s", wait, err)
+	}
+	ageLoginFailures(t, 2*time.Second)
+
+	// The failure reaching MaxFailures locks the account
+	if !failLogin(t, user, ip, limits) {
+		t.Fatal("third failure didn't lock the account")
+	}
+	if _, wait, err := BeginLogin(user, ip, limits); !errors.Is(err, ErrAccountLocked) || wait < 14*time.Minute {
+		t.Errorf("locked account: wait %v, %v; want ErrAccountLocked for about 15m", wait, err)
+	}
+	lockedUsers, err := GetLockedUsers()
+	if err != nil || len(lockedUsers) != 1 || lockedUsers[0].ID != user {
+		t.Errorf("locked users: %+v, %v", lockedUsers, err)
+	}
+
+	// The lock runs out by itself, and the failures before it no longer count
+	ageLoginFailures(t, 16*time.Minute)
+	if failLogin(t, user, ip, limits) {
+		t.Error("the first failure after the lockout locked the account again")
+	}
+
+	// Or an admin lifts it
+	for i := 0; i < 2; i++ {
+		ageLoginFailures(t, 10*time.Second)
+		failLogin(t, user, ip, limits)
+	}
+	if _, _, err := BeginLogin(user, ip, limits); !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("locked again: got %v, want ErrAccountLocked", err)
+	}
+	if err := UnlockUser(user, user, "it's me"); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("member unlocking: got %v, want ErrNotAdmin", err)
+	}
+	if err := UnlockUser(admin, user, "verified by email"); err != nil {
+		t.Fatal(err)
+	}
+	actions, err := GetModActions(1)
+	if err != nil || actions[0].Action != ActionUnlockUser || actions[0].TargetID != user {
+		t.Errorf("unlock logged as %+v, %v", actions, err)
+	}
+
+	// The next login tells the owner about every failure since the last one
+	succeedLogin(t, user, ip, limits)
+	notifications, err := GetNotifications(user, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 1 || !strings.Contains(notifications[0].Message, "6 failed logins") {
+		t.Errorf("notifications: %+v", notifications)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM login_failures WHERE user_id = ?", user); n != 0 {
+		t.Errorf("%d failures left after logging in", n)
+	}
+	succeedLogin(t, user, ip, limits)
+	if n, err := CountUnreadNotifications(user); err != nil || n != 1 {
+		t.Errorf("a login without failures notified: %d unread, %v", n, err)
+	}
+}
+
+func TestLoginIPBlock(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "user")
+	limits := LoginLimits{MaxFailures: 100, IPMaxFailures: 3, Lockout: 15 * time.Minute}
+	const ip = "192.0.2.1"
+
+	// Guessing names that don't exist still counts against the address
+	for i := 0; i < 3; i++ {
+		failLogin(t, 0, ip, limits)
+	}
+	if _, wait, err := BeginLogin(user, ip, limits); !errors.Is(err, ErrLoginThrottled) || wait < 14*time.Minute {
+		t.Errorf("blocked address: wait %v, %v; want ErrLoginThrottled for about 15m", wait, err)
+	}
+	succeedLogin(t, user, "192.0.2.2", limits)
+
+	ageLoginFailures(t, 16*time.Minute)
+	succeedLogin(t, user, ip, limits)
+	// Old failures without an account are cleaned up
+	failLogin(t, 0, ip, limits)
+	if n := count(t, "SELECT COUNT(*) FROM login_failures"); n != 1 {
+		t.Errorf("%d failures kept, want 1", n)
+	}
+
+	// So are old failures at an account that never logs in
+	dormant := createTestUser(t, "dormant")
+	failLogin(t, dormant, "192.0.2.3", limits)
+	ageLoginFailures(t, 16*time.Minute)
+	failLogin(t, 0, "192.0.2.4", limits)
+	if n := count(t, "SELECT COUNT(*) FROM login_failures WHERE user_id = ?", dormant); n != 0 {
+		t.Errorf("%d old failures of a dormant account kept, want 0", n)
+	}
+	if n := count(t, "SELECT pruned_login_failures FROM users WHERE id = ?", dormant); n != 1 {
+		t.Errorf("%d pruned failures counted for the owner, want 1", n)
+	}
+}
+
+// Guesses made at the same time see each other, so they can't all pass the
+// check before the first one is recorded.
+func TestLoginConcurrentGuesses(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "victim")
+
+	tests := []struct {
+		name    string
+		userID  int
+		ip      func(i int) string
+		limits  LoginLimits
+		allowed int
+	}{
+		// The first failure makes the next guess wait
+		{"account", user, func(i int) string { return "192.0.2." + strconv.Itoa(i) }, LoginLimits{MaxFailures: 3, Lockout: time.Minute}, 1},
+		{"address", 0, func(int) string { return "198.51.100.1" }, LoginLimits{IPMaxFailures: 3, Lockout: time.Minute}, 3},
+	}
+	for _, tt := range tests {
+		const guesses = 20
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		allowed := 0
+		errs := make(chan error, guesses)
+		for i := 0; i < guesses; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, _, err := BeginLogin(tt.userID, tt.ip(i), tt.limits)
+				if errors.Is(err, ErrLoginThrottled) || errors.Is(err, ErrAccountLocked) {
+					return
+				}
+				if err == nil {
+					_, err = RecordLoginFailure(tt.userID, tt.limits)
+				}
+				if err == nil {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+				errs <- err
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		if allowed != tt.allowed {
+			t.Errorf("%s: %d of %d guesses at once were tried, want %d", tt.name, allowed, guesses, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// User roles. Moderators can use the moderator tools; admins can also give
+// and take roles.
+const (
+	RoleMember    = "member"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists the roles from least to most powerful.
+var Roles = []string{RoleMember, RoleModerator, RoleAdmin}
+
+// Moderator actions, as recorded in the audit log.
+const (
+	ActionHidePost       = "hide_post"
+	ActionUnhidePost     = "unhide_post"
+	ActionLockPost       = "lock_post"
+	ActionUnlockPost     = "unlock_post"
+	ActionMovePost       = "move_post"
+	ActionDeletePost     = "delete_post"
+	ActionHideComment    = "hide_comment"
+	ActionUnhideComment  = "unhide_comment"
+	ActionDeleteComment  = "delete_comment"
+	ActionSetRole        = "set_role"
+	ActionResolveReports = "resolve_reports"
+	ActionDismissReports = "dismiss_reports"
+	ActionUnlockUser     = "unlock_user"
+)
+
+var ErrNotModerator = errors.New("moderator role required")
+var ErrNotAdmin = errors.New("admin role required")
+var ErrUserNotFound = errors.New("user not found")
+var ErrInvalidRole = errors.New("invalid role")
+var ErrOwnRole = errors.New("admins can't change their own role")
+var ErrInvalidAction = errors.New("invalid moderator action")
+var ErrReasonRequired = errors.New("moderator actions need a reason")
+var ErrPostLocked = errors.New("post is locked")
+
+// IsModerator reports whether the user may use the moderator tools.
+func (u *User) IsModerator() bool {
+	return u.Role == RoleModerator || u.Role == RoleAdmin
+}
+
+// IsAdmin reports whether the user may change roles.
+func (u *User) IsAdmin() bool {
+	return u.Role == RoleAdmin
+}
+
+// ModAction is an entry of the moderation audit log.
+type ModAction struct {
+	ID        int
+	ActorID   int    // 0 when the action didn't come from a user
+	Actor     string // username of the actor; empty when ActorID is 0
+	Action    string // one of the Action* constants
+	Target    string // "post", "comment" or "user"
+	TargetID  int
+	Reason    string
+	Details   string // what changed, e.g. the new categories or the text of a deleted comment
+	CreatedAt time.Time
+}
+
+// moderate runs a moderator action in one transaction: it checks that the
+// actor holds role, lets apply make the change and records it in the audit
+// log. apply returns the details to log.
+func moderate(actorID int, role string, entry ModAction, apply func(tx *sql.Tx) (string, error)) error {
+	entry.Reason = strings.TrimSpace(entry.Reason)
+	if entry.Reason == "" {
+		return ErrReasonRequired
+	}
+	if err := validateReason(entry.Reason); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkRole(tx, actorID, role); err != nil {
+		return err
+	}
+	entry.Details, err = apply(tx)
+	if err != nil {
+		return err
+	}
+	entry.ActorID = actorID
+	if err := logModAction(tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// checkRole makes sure the user holds role or a more powerful one.
+func checkRole(tx *sql.Tx, userID int, role string) error {
+	var have string
+	err := tx.QueryRow("SELECT role FROM users WHERE id = ?", userID).Scan(&have)
+	if err == sql.ErrNoRows {
+		return ErrUserNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if roleLevel(have) < roleLevel(role) {
+		if role == RoleAdmin {
+			return ErrNotAdmin
+		}
+		return ErrNotModerator
+	}
+	return nil
+}
+
+func roleLevel(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// logModAction writes an audit log entry. An ActorID of 0 is stored as NULL.
+func logModAction(tx *sql.Tx, entry ModAction) error {
+	var actor interface{}
+	if entry.ActorID != 0 {
+		actor = entry.ActorID
+	}
+	_, err := tx.Exec(`INSERT INTO mod_actions (actor_id, action, target, target_id, reason, details, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		actor, entry.Action, entry.Target, entry.TargetID, entry.Reason, entry.Details, sqlTime(time.Now()))
+	return err
+}
+
+// postFlags are the post actions that set or clear a timestamp column.
+var postFlags = map[string]struct {
+	column string
+	set    bool
+}{
+	ActionHidePost:   {"hidden_at", true},
+	ActionUnhidePost: {"hidden_at", false},
+	ActionLockPost:   {"locked_at", true},
+	ActionUnlockPost: {"locked_at", false},
+}
+
+// ModeratePost hides, unhides, locks, unlocks or deletes any post. Hidden
+// posts vanish from listings, search and the post page for everyone but
+// moderators. Locked posts take no new comments.
+func ModeratePost(actorID, postID int, action, reason string) error {
+	entry := ModAction{Action: action, Target: "post", TargetID: postID, Reason: reason}
+	if action == ActionDeletePost {
+		return moderate(actorID, RoleModerator, entry, func(tx *sql.Tx) (string, error) {
+			var title string
+			if err := tx.QueryRow("SELECT title FROM posts WHERE id = ?", postID).Scan(&title); err == sql.ErrNoRows {
+				return "", ErrPostNotFound
+			} else if err != nil {
+				return "", err
+			}
+			return title, deletePost(tx, postID)
+		})
+	}
+
+	flag, ok := postFlags[action]
+	if !ok {
+		return ErrInvalidAction
+	}
+	return moderate(actorID, RoleModerator, entry, func(tx *sql.Tx) (string, error) {
+		res, err := setFlag(tx, "posts", flag.column, flag.set, postID)
+		if err != nil {
+			return "", err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return "", ErrPostNotFound
+		}
+		return "", nil
+	})
+}
+
+// setFlag sets a timestamp column to now, keeping an earlier time if it was
+// already set, or clears it.
+func setFlag(tx *sql.Tx, table, column string, set bool, id int) (sql.Result, error) {
+	if !set {
+		return tx.Exec("UPDATE "+table+" SET "+column+" = NULL WHERE id = ?", id)
+	}
+	return tx.Exec("UPDATE "+table+" SET "+column+" = COALESCE("+column+", ?) WHERE id = ?", sqlTime(time.Now()), id)
+}
+
+// MovePost files any post under other categories.
+func MovePost(actorID, postID int, categoryIDs []int, reason string) error {
+	entry := ModAction{Action: ActionMovePost, Target: "post", TargetID: postID, Reason: reason}
+	return moderate(actorID, RoleModerator, entry, func(tx *sql.Tx) (string, error) {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM posts WHERE id = ?)", postID).Scan(&exists); err != nil {
+			return "", err
+		}
+		if !exists {
+			return "", ErrPostNotFound
+		}
+		if err := setPostCategories(tx, postID, categoryIDs); err != nil {
+			return "", err
+		}
+		var names sql.NullString
+		err := tx.QueryRow(`SELECT group_concat(c.name, ', ') FROM post_categories pc
+			JOIN categories c ON c.id = pc.category_id WHERE pc.post_id = ?`, postID).Scan(&names)
+		return "to " + names.String, err
+	})
+}
+
+// ModerateComment hides, unhides or deletes any comment. Hidden comments
+// keep their place in the thread but only moderators see their text.
+// Deleting leaves a tombstone like the author's own delete; the log keeps
+// the deleted text.
+func ModerateComment(actorID, commentID int, action, reason string) error {
+	if action != ActionHideComment && action != ActionUnhideComment && action != ActionDeleteComment {
+		return ErrInvalidAction
+	}
+	entry := ModAction{Action: action, Target: "comment", TargetID: commentID, Reason: reason}
+	return moderate(actorID, RoleModerator, entry, func(tx *sql.Tx) (string, error) {
+		var text string
+		err := tx.QueryRow("SELECT comment FROM comments WHERE id = ? AND deleted_at IS NULL", commentID).Scan(&text)
+		if err == sql.ErrNoRows {
+			return "", ErrCommentNotFound
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if action == ActionDeleteComment {
+			_, err := tx.Exec("UPDATE comments SET comment = '', deleted_at = ?, score = 0 WHERE id = ?",
+				sqlTime(time.Now()), commentID)
+			return text, err
+		}
+		_, err = setFlag(tx, "comments", "hidden_at", action == ActionHideComment, commentID)
+		return "", err
+	})
+}
+
+// SetUserRole gives a user another role. Only admins may, and not to
+// themselves, so the last admin can't lock everyone out by accident.
+func SetUserRole(actorID, userID int, role, reason string) error {
+	if roleLevel(role) == 0 {
+		return ErrInvalidRole
+	}
+	if actorID == userID {
+		return ErrOwnRole
+	}
+	entry := ModAction{Action: ActionSetRole, Target: "user", TargetID: userID, Reason: reason}
+	return moderate(actorID, RoleAdmin, entry, func(tx *sql.Tx) (string, error) {
+		return setRole(tx, userID, role)
+	})
+}
+
+// SetUserRoleByName sets a user's role without an acting admin, for the
+// -set-role command line option. It is logged with no actor.
+func SetUserRoleByName(username, role string) error {
+	if roleLevel(role) == 0 {
+		return ErrInvalidRole
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	if err := tx.QueryRow("SELECT id FROM users WHERE username = ?", username).Scan(&userID); err == sql.ErrNoRows {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+	details, err := setRole(tx, userID, role)
+	if err != nil {
+		return err
+	}
+	entry := ModAction{Action: ActionSetRole, Target: "user", TargetID: userID, Reason: "set from the command line", Details: details}
+	if err := logModAction(tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func setRole(tx *sql.Tx, userID int, role string) (string, error) {
+	var username, old string
+	err := tx.QueryRow("SELECT username, role FROM users WHERE id = ?", userID).Scan(&username, &old)
+	if err == sql.ErrNoRows {
+		return "", ErrUserNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID); err != nil {
+		return "", err
+	}
+	return username + ": " + old + " → " + role, nil
+}
+
+// GetModActions returns the newest entries of the audit log.
+func GetModActions(limit int) ([]ModAction, error) {
+	rows, err := db.Query(`SELECT m.id, COALESCE(m.actor_id, 0), COALESCE(u.username, ''), m.action, m.target,
+			m.target_id, m.reason, m.details, m.created_at
+		FROM mod_actions m LEFT JOIN users u ON u.id = m.actor_id
+		ORDER BY m.id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var actions []ModAction
+	for rows.Next() {
+		var a ModAction
+		if err := rows.Scan(&a.ID, &a.ActorID, &a.Actor, &a.Action, &a.Target, &a.TargetID, &a.Reason, &a.Details, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+// GetStaff lists the moderators and admins.
+func GetStaff() ([]User, error) {
+	rows, err := db.Query("SELECT id, username, role FROM users WHERE role != ? ORDER BY role, username", RoleMember)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
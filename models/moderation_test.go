@@ -0,0 +1,172 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestModeratePost(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	mod := createTestUser(t, "mod")
+	postID := createTestPost(t, author)
+
+	if err := ModeratePost(author, postID, ActionHidePost, "spam"); !errors.Is(err, ErrNotModerator) {
+		t.Errorf("member hiding: got %v, want ErrNotModerator", err)
+	}
+	if err := SetUserRoleByName("mod", RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	if err := ModeratePost(mod, postID, ActionHidePost, "  "); !errors.Is(err, ErrReasonRequired) {
+		t.Errorf("no reason: got %v, want ErrReasonRequired", err)
+	}
+	var invalid ValidationError
+	if err := ModeratePost(mod, postID, ActionHidePost, strings.Repeat("x", MaxReasonLength+1)); !errors.As(err, &invalid) {
+		t.Errorf("long reason: got %v, want a ValidationError", err)
+	}
+	if err := ModeratePost(mod, postID, "explode_post", "spam"); !errors.Is(err, ErrInvalidAction) {
+		t.Errorf("unknown action: got %v, want ErrInvalidAction", err)
+	}
+	if err := ModeratePost(mod, postID+1, ActionHidePost, "spam"); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("missing post: got %v, want ErrPostNotFound", err)
+	}
+
+	if err := ModeratePost(mod, postID, ActionHidePost, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	page, err := ListPosts(PostQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Posts) != 0 {
+		t.Errorf("hidden post listed: %+v", page.Posts)
+	}
+	if page, err = ListPosts(PostQuery{Hidden: true}); err != nil || len(page.Posts) != 1 || !page.Posts[0].Hidden {
+		t.Errorf("hidden listing: %+v, %v", page, err)
+	}
+	if err := SetReaction(postID, mod, ReactionLike); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("reacting to a hidden post: got %v, want ErrPostNotFound", err)
+	}
+	if _, err := CreateComment(mod, strconv.Itoa(postID), "hi", 0); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("commenting on a hidden post: got %v, want ErrPostNotFound", err)
+	}
+
+	if err := ModeratePost(mod, postID, ActionUnhidePost, "not spam"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ModeratePost(mod, postID, ActionLockPost, "heated"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CreateComment(author, strconv.Itoa(postID), "hi", 0); !errors.Is(err, ErrPostLocked) {
+		t.Errorf("commenting on a locked post: got %v, want ErrPostLocked", err)
+	}
+
+	// Failed actions leave no trace in the log
+	actions, err := GetModActions(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{ActionLockPost, ActionUnhidePost, ActionHidePost, ActionSetRole}
+	if len(actions) != len(want) {
+		t.Fatalf("%d log entries, want %d: %+v", len(actions), len(want), actions)
+	}
+	for i, action := range actions {
+		if action.Action != want[i] {
+			t.Errorf("entry %d: %s, want %s", i, action.Action, want[i])
+		}
+	}
+	if actions[0].Actor != "mod" || actions[0].Reason != "heated" || actions[0].TargetID != postID {
+		t.Errorf("lock entry: %+v", actions[0])
+	}
+	if actions[3].ActorID != 0 {
+		t.Errorf("command line role change logged with actor %d", actions[3].ActorID)
+	}
+}
+
+func TestModerateComment(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	mod := createTestUser(t, "mod")
+	if err := SetUserRoleByName("mod", RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	postID := createTestPost(t, author)
+	commentID, err := CreateComment(author, strconv.Itoa(postID), "rude words", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ModerateComment(mod, commentID, ActionHideComment, "rude"); err != nil {
+		t.Fatal(err)
+	}
+	comment, err := GetCommentByID(commentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comment.Hidden {
+		t.Error("comment not hidden")
+	}
+
+	if err := ModerateComment(mod, commentID, ActionDeleteComment, "very rude"); err != nil {
+		t.Fatal(err)
+	}
+	if comment, err = GetCommentByID(commentID); err != nil || comment.Deleted_at == "" {
+		t.Errorf("comment not deleted: %+v, %v", comment, err)
+	}
+	actions, err := GetModActions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions[0].Details != "rude words" {
+		t.Errorf("deleted text not logged: %+v", actions[0])
+	}
+	if err := ModerateComment(mod, commentID, ActionHideComment, "again"); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("hiding a deleted comment: got %v, want ErrCommentNotFound", err)
+	}
+}
+
+func TestSetUserRole(t *testing.T) {
+	setupTestDB(t)
+	admin := createTestUser(t, "admin")
+	mod := createTestUser(t, "mod")
+	member := createTestUser(t, "member")
+	if err := SetUserRoleByName("admin", RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetUserRole(admin, mod, RoleModerator, "helps out"); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetUserRole(mod, member, RoleModerator, "friend"); !errors.Is(err, ErrNotAdmin) {
+		t.Errorf("moderator giving roles: got %v, want ErrNotAdmin", err)
+	}
+	if err := SetUserRole(admin, admin, RoleMember, "retiring"); !errors.Is(err, ErrOwnRole) {
+		t.Errorf("own role: got %v, want ErrOwnRole", err)
+	}
+	if err := SetUserRole(admin, member, "overlord", "why not"); !errors.Is(err, ErrInvalidRole) {
+		t.Errorf("unknown role: got %v, want ErrInvalidRole", err)
+	}
+	if err := SetUserRole(admin, member+100, RoleModerator, "ghost"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("missing user: got %v, want ErrUserNotFound", err)
+	}
+	if err := SetUserRoleByName("nobody", RoleAdmin); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("missing username: got %v, want ErrUserNotFound", err)
+	}
+
+	staff, err := GetStaff()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staff) != 2 || staff[0].Username != "admin" || staff[1].Username != "mod" {
+		t.Errorf("staff: %+v", staff)
+	}
+	user, err := GetUserByID(mod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.IsModerator() || user.IsAdmin() {
+		t.Errorf("moderator role: %+v", user)
+	}
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Notification is a message for a user, such as the outcome of a report.
+type Notification struct {
+	ID        int
+	Message   string
+	Link      string // where the notification points to; may be empty
+	CreatedAt time.Time
+	Read      bool
+}
+
+// notify stores a notification for userID as part of tx.
+func notify(tx *sql.Tx, userID int, message, link string) error {
+	_, err := tx.Exec("INSERT INTO notifications (user_id, message, link, created_at) VALUES (?, ?, ?, ?)",
+		userID, message, link, sqlTime(time.Now()))
+	return err
+}
+
+// GetNotifications returns the newest notifications of a user.
+func GetNotifications(userID, limit int) ([]Notification, error) {
+	rows, err := db.Query(`SELECT id, message, link, created_at, read_at IS NOT NULL
+		FROM notifications WHERE user_id = ? ORDER BY id DESC LIMIT ?`, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Message, &n.Link, &n.CreatedAt, &n.Read); err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications counts the notifications a user hasn't seen yet.
+func CountUnreadNotifications(userID int) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL", userID).Scan(&n)
+	return n, err
+}
+
+// MarkNotificationsRead marks every notification of a user as seen.
+func MarkNotificationsRead(userID int) error {
+	_, err := db.Exec("UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL", sqlTime(time.Now()), userID)
+	return err
+}
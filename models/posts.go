@@ -0,0 +1,239 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sort modes understood by ListPosts.
+const (
+	SortNewest   = "newest"   // most recently created first
+	SortOldest   = "oldest"   // first created first
+	SortTop      = "top"      // highest likes minus dislikes first
+	SortComments = "comments" // most comments first
+	SortActive   = "active"   // most recent post, edit or comment first
+)
+
+// SortModes lists the sort modes in the order the UI offers them.
+var SortModes = []string{SortNewest, SortOldest, SortTop, SortComments, SortActive}
+
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+var ErrInvalidSort = errors.New("invalid sort mode")
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// PostQuery selects one page of posts. The filters are combined; zero values
+// mean "don't filter".
+type PostQuery struct {
+	CategoryID int    // only posts filed under this category
+	AuthorID   int    // only posts written by this user
+	LikedBy    int    // only posts this user liked
+	Hidden     bool   // only posts moderators have hidden, instead of only visible ones
+	Sort       string // one of the Sort* modes; SortNewest when empty
+	Before     string // cursor from PostPage.Next: the page following it
+	After      string // cursor from PostPage.Prev: the page preceding it
+	Limit      int    // page size; DefaultPageSize when 0, capped at MaxPageSize
+}
+
+// PostPage is one page of posts with the cursors of its neighbours.
+type PostPage struct {
+	Posts []Post
+	Next  string // pass as PostQuery.Before for the next page; empty on the last page
+	Prev  string // pass as PostQuery.After for the previous page; empty on the first page
+}
+
+// sortSpec describes how a sort mode orders posts. Every mode breaks ties on
+// the post ID, so (key, id) identifies a position in the listing.
+type sortSpec struct {
+	key     string // SQL expression for the sort key, over posts p
+	numeric bool   // whether key is an integer rather than a timestamp
+	desc    bool
+}
+
+var sortSpecs = map[string]sortSpec{
+	SortNewest: {key: "p.id", numeric: true, desc: true},
+	SortOldest: {key: "p.id", numeric: true, desc: false},
+	SortTop:    {key: "p.score", numeric: true, desc: true},
+	SortComments: {key: "(SELECT COUNT(*) FROM comments c WHERE c.post_id = p.id AND c.deleted_at IS NULL)",
+		numeric: true, desc: true},
+	SortActive: {key: `MAX(COALESCE(p.updated_at, p.created_at), COALESCE((SELECT MAX(c.created_at) FROM comments c
+		WHERE c.post_id = p.id AND c.deleted_at IS NULL AND c.hidden_at IS NULL), ''))`,
+		numeric: false, desc: true},
+}
+
+// ListPosts returns one page of posts using keyset pagination: instead of an
+// OFFSET, each page starts right after the (sort key, id) of the last post on
+// the page before, so pages stay stable while new posts arrive.
+func ListPosts(q PostQuery) (*PostPage, error) {
+	if q.Sort == "" {
+		q.Sort = SortNewest
+	}
+	spec, ok := sortSpecs[q.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		q.Limit = MaxPageSize
+	}
+
+	where := []string{"p.hidden_at IS NULL"}
+	if q.Hidden {
+		where[0] = "p.hidden_at IS NOT NULL"
+	}
+	var args []interface{}
+	if q.CategoryID != 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM post_categories pc WHERE pc.post_id = p.id AND pc.category_id = ?)")
+		args = append(args, q.CategoryID)
+	}
+	if q.AuthorID != 0 {
+		where = append(where, "p.user_id = ?")
+		args = append(args, q.AuthorID)
+	}
+	if q.LikedBy != 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM reactions r WHERE r.target = 'post' AND r.target_id = p.id AND r.user_id = ? AND r.type = ?)")
+		args = append(args, q.LikedBy, ReactionLike)
+	}
+
+	// Walking backwards (towards the previous page) flips the order; the
+	// rows are put back in display order below.
+	backwards := q.After != ""
+	cursor := q.Before
+	if backwards {
+		cursor = q.After
+	}
+	desc := spec.desc != backwards
+	order, cmp := "ASC", ">"
+	if desc {
+		order, cmp = "DESC", "<"
+	}
+
+	// The filters apply to posts p; the cursor applies to the computed
+	// sort_key, so it goes on the outer query.
+	query := `
+		SELECT id, user_id, title, content, Author, created_at, updated_at, score, hidden, locked, sort_key FROM (
+			SELECT p.id, p.user_id, p.title, p.content, p.Author, p.created_at, p.updated_at, p.score,
+				p.hidden_at IS NOT NULL AS hidden, p.locked_at IS NOT NULL AS locked,
+				` + spec.key + ` AS sort_key
+			FROM posts p
+			WHERE ` + strings.Join(where, " AND ") + `
+		)`
+	if cursor != "" {
+		key, id, err := decodeCursor(cursor, spec.numeric)
+		if err != nil {
+			return nil, err
+		}
+		query += `
+		WHERE sort_key ` + cmp + ` ? OR (sort_key = ? AND id ` + cmp + ` ?)`
+		args = append(args, key, key, id)
+	}
+	query += `
+		ORDER BY sort_key ` + order + `, id ` + order + `
+		LIMIT ?`
+	args = append(args, q.Limit+1)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []Post
+	var keys []string
+	for rows.Next() {
+		var post Post
+		var createdAt time.Time
+		var updatedAt sql.NullTime
+		var key string
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Title, &post.Content, &post.Author, &createdAt, &updatedAt, &post.Score, &post.Hidden, &post.Locked, &key); err != nil {
+			return nil, err
+		}
+		post.Created_at = createdAt.Format("2006-01-02 15:04:05")
+		if updatedAt.Valid {
+			post.Updated_at = updatedAt.Time.Format("2006-01-02 15:04:05")
+		}
+		posts = append(posts, post)
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	more := len(posts) > q.Limit
+	if more {
+		posts, keys = posts[:q.Limit], keys[:q.Limit]
+	}
+	if backwards {
+		reverse(posts)
+		reverse(keys)
+	}
+
+	page := &PostPage{Posts: posts}
+	if len(posts) > 0 {
+		first := encodeCursor(keys[0], posts[0].ID)
+		last := encodeCursor(keys[len(keys)-1], posts[len(posts)-1].ID)
+		if backwards {
+			page.Next = last
+			if more {
+				page.Prev = first
+			}
+		} else {
+			if more {
+				page.Next = last
+			}
+			if q.Before != "" {
+				page.Prev = first
+			}
+		}
+	}
+	if err := attachCategories(page.Posts); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// encodeCursor turns a position in a listing into an opaque URL-safe string.
+func encodeCursor(key string, id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key + "|" + strconv.Itoa(id)))
+}
+
+// decodeCursor reverses encodeCursor. The key comes back as an int for
+// numeric sort modes so SQLite compares it as a number.
+func decodeCursor(cursor string, numeric bool) (interface{}, int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	i := strings.LastIndex(string(raw), "|")
+	if i < 0 {
+		return nil, 0, ErrInvalidCursor
+	}
+	id, err := strconv.Atoi(string(raw[i+1:]))
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	key := string(raw[:i])
+	if !numeric {
+		return key, id, nil
+	}
+	n, err := strconv.Atoi(key)
+	if err != nil {
+		return nil, 0, ErrInvalidCursor
+	}
+	return n, id, nil
+}
+
+func reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
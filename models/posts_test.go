@@ -0,0 +1,366 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// setupTestDB points the package at a fresh database file.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	t.Cleanup(func() { CloseDB() })
+}
+
+// createTestUser inserts a user and returns their ID.
+func createTestUser(t *testing.T, name string) int {
+	t.Helper()
+	if err := CreateUser(User{Email: name + "@example.com", Username: name, Password: "x"}); err != nil {
+		t.Fatal(err)
+	}
+	user, err := GetUserByUserName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user.ID
+}
+
+// createTestPost creates a post by userID and returns its ID.
+func createTestPost(t *testing.T, userID int) int {
+	t.Helper()
+	postID, err := CreatePost(userID, "Title", "Content", []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return postID
+}
+
+func count(t *testing.T, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestUpdatePostOwnership(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	other := createTestUser(t, "other")
+	postID := createTestPost(t, author)
+	id := strconv.Itoa(postID)
+
+	err := UpdatePost(postID, other, "Hijacked", "Hijacked", []int{2})
+	if !errors.Is(err, ErrNotPostAuthor) {
+		t.Fatalf("UpdatePost by another user: got %v, want ErrNotPostAuthor", err)
+	}
+	post, err := GetPostByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "Title" || post.Updated_at != "" {
+		t.Errorf("post changed by another user: %+v", post)
+	}
+
+	if err := UpdatePost(postID, author, "New title", "New content", []int{2, 3}); err != nil {
+		t.Fatalf("UpdatePost by author: %v", err)
+	}
+	post, err = GetPostByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "New title" || post.Content != "New content" {
+		t.Errorf("post not updated: %+v", post)
+	}
+	if post.Updated_at == "" {
+		t.Error("Updated_at not set after edit")
+	}
+	if len(post.Category) != 2 {
+		t.Errorf("got %d categories, want 2", len(post.Category))
+	}
+
+	if err := UpdatePost(postID+1, author, "x", "x", []int{1}); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("UpdatePost of missing post: got %v, want ErrPostNotFound", err)
+	}
+}
+
+func TestPostCategoriesMustExist(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	mod := createTestUser(t, "mod")
+	if err := SetUserRoleByName("mod", RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	postID := createTestPost(t, author)
+
+	var invalid ValidationError
+	if _, err := CreatePost(author, "Title", "Content", []int{1, 99}); !errors.As(err, &invalid) || invalid["categories"] == "" {
+		t.Errorf("CreatePost: got %v, want a categories ValidationError", err)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM posts"); n != 1 {
+		t.Errorf("%d posts, want the refused one left out", n)
+	}
+	if err := UpdatePost(postID, author, "Title", "Content", []int{-1}); !errors.As(err, &invalid) {
+		t.Errorf("UpdatePost: got %v, want a ValidationError", err)
+	}
+	for _, categoryIDs := range [][]int{{99}, nil} {
+		if err := MovePost(mod, postID, categoryIDs, "tidy up"); !errors.As(err, &invalid) {
+			t.Errorf("MovePost to %v: got %v, want a ValidationError", categoryIDs, err)
+		}
+	}
+	if n := count(t, "SELECT COUNT(*) FROM post_categories WHERE post_id = ? AND category_id = 1", postID); n != 1 {
+		t.Error("refused changes touched the categories of the post")
+	}
+	if n := count(t, "SELECT COUNT(*) FROM mod_actions WHERE action = ?", ActionMovePost); n != 0 {
+		t.Errorf("%d refused moves logged", n)
+	}
+
+	if err := MovePost(mod, postID, []int{2, 3, 2}, "tidy up"); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM post_categories WHERE post_id = ?", postID); n != 2 {
+		t.Errorf("moved post has %d categories, want 2", n)
+	}
+}
+
+func TestDeletePostOwnership(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	other := createTestUser(t, "other")
+	postID := createTestPost(t, author)
+	id := strconv.Itoa(postID)
+
+	if _, err := CreateComment(other, id, "a comment", 0); err != nil {
+		t.Fatal(err)
+	}
+	comments, err := GetCommentsByPostID(id)
+	if err != nil || len(comments) != 1 {
+		t.Fatalf("comment not created: %v", err)
+	}
+	if err := SetReaction(postID, other, ReactionLike); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCommentReaction(comments[0].ID, author, ReactionLike); err != nil {
+		t.Fatal(err)
+	}
+	if count(t, "SELECT COUNT(*) FROM reactions") != 2 {
+		t.Fatal("reactions not created")
+	}
+
+	if err := DeletePost(postID, other); !errors.Is(err, ErrNotPostAuthor) {
+		t.Fatalf("DeletePost by another user: got %v, want ErrNotPostAuthor", err)
+	}
+	if _, err := GetPostByID(id); err != nil {
+		t.Fatalf("post deleted by another user: %v", err)
+	}
+
+	if err := DeletePost(postID, author); err != nil {
+		t.Fatalf("DeletePost by author: %v", err)
+	}
+	if _, err := GetPostByID(id); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("post still there after delete: %v", err)
+	}
+	for table, query := range map[string]string{
+		"comments":        "SELECT COUNT(*) FROM comments WHERE post_id = ?",
+		"reactions":       "SELECT COUNT(*) FROM reactions WHERE target = 'post' AND target_id = ?",
+		"post_categories": "SELECT COUNT(*) FROM post_categories WHERE post_id = ?",
+	} {
+		if n := count(t, query, postID); n != 0 {
+			t.Errorf("%d %s rows left after delete", n, table)
+		}
+	}
+	if n := count(t, "SELECT COUNT(*) FROM reactions"); n != 0 {
+		t.Errorf("%d comment reactions left after delete", n)
+	}
+
+	if err := DeletePost(postID, author); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("second DeletePost: got %v, want ErrPostNotFound", err)
+	}
+}
+
+// pagingFixture is a post in TestListPostsPaging with the values its sort
+// keys are made of. Small ranges make plenty of ties.
+type pagingFixture struct {
+	id       int
+	score    int
+	comments int
+	active   time.Time
+}
+
+func TestListPostsPaging(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	commenter := createTestUser(t, "commenter")
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	var fixtures []pagingFixture
+	for i := 0; i < 11; i++ {
+		f := pagingFixture{id: createTestPost(t, author), score: i % 3, comments: i % 4, active: base.Add(time.Duration(i%5) * time.Minute)}
+		for c := 0; c < f.comments; c++ {
+			if _, err := CreateComment(commenter, strconv.Itoa(f.id), "comment", 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Comments are older than the post's edit, so the edit is its
+		// last activity
+		if _, err := db.Exec("UPDATE posts SET score = ?, updated_at = ? WHERE id = ?", f.score, sqlTime(f.active), f.id); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("UPDATE comments SET created_at = ? WHERE post_id = ?", sqlTime(f.active.Add(-time.Hour)), f.id); err != nil {
+			t.Fatal(err)
+		}
+		fixtures = append(fixtures, f)
+	}
+	// A hidden post shows up in no listing
+	hidden := createTestPost(t, author)
+	if _, err := db.Exec("UPDATE posts SET hidden_at = ? WHERE id = ?", sqlTime(base), hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every mode breaks ties on the ID, in the direction of its key
+	orders := map[string]func(a, b pagingFixture) bool{
+		SortNewest: func(a, b pagingFixture) bool { return a.id > b.id },
+		SortOldest: func(a, b pagingFixture) bool { return a.id < b.id },
+		SortTop: func(a, b pagingFixture) bool {
+			return a.score > b.score || a.score == b.score && a.id > b.id
+		},
+		SortComments: func(a, b pagingFixture) bool {
+			return a.comments > b.comments || a.comments == b.comments && a.id > b.id
+		},
+		SortActive: func(a, b pagingFixture) bool {
+			return a.active.After(b.active) || a.active.Equal(b.active) && a.id > b.id
+		},
+	}
+	for _, sortMode := range SortModes {
+		want := append([]pagingFixture(nil), fixtures...)
+		sort.Slice(want, func(i, j int) bool { return orders[sortMode](want[i], want[j]) })
+		var wantIDs []int
+		for _, f := range want {
+			wantIDs = append(wantIDs, f.id)
+		}
+
+		// Forwards through every page, then backwards from the last one
+		var pages [][]int
+		q := PostQuery{Sort: sortMode, Limit: 3}
+		for {
+			page, err := ListPosts(q)
+			if err != nil {
+				t.Fatalf("%s: %v", sortMode, err)
+			}
+			if (q.Before == "") != (page.Prev == "") {
+				t.Errorf("%s: page %d has prev cursor %q", sortMode, len(pages)+1, page.Prev)
+			}
+			pages = append(pages, postIDs(page.Posts))
+			if page.Next == "" {
+				q.After = page.Prev
+				break
+			}
+			q.Before = page.Next
+		}
+		if got := concat(pages); !slices.Equal(got, wantIDs) {
+			t.Errorf("%s forwards: %v, want %v", sortMode, got, wantIDs)
+		}
+
+		q.Before = ""
+		for i := len(pages) - 2; i >= 0; i-- {
+			page, err := ListPosts(q)
+			if err != nil {
+				t.Fatalf("%s backwards: %v", sortMode, err)
+			}
+			if got := postIDs(page.Posts); !slices.Equal(got, pages[i]) {
+				t.Errorf("%s backwards, page %d: %v, want %v", sortMode, i+1, got, pages[i])
+			}
+			if (i == 0) != (page.Prev == "") || page.Next == "" {
+				t.Errorf("%s backwards, page %d: cursors prev %q, next %q", sortMode, i+1, page.Prev, page.Next)
+			}
+			q.After = page.Prev
+		}
+	}
+}
+
+func TestListPostsRefusesBadInput(t *testing.T) {
+	setupTestDB(t)
+	createTestPost(t, createTestUser(t, "author"))
+
+	if _, err := ListPosts(PostQuery{Sort: "random"}); !errors.Is(err, ErrInvalidSort) {
+		t.Errorf("unknown sort: got %v, want ErrInvalidSort", err)
+	}
+	cursors := map[string]string{
+		"not base64":      "!!!",
+		"no separator":    encodeBase64("12"),
+		"non-numeric id":  encodeBase64("12|x"),
+		"non-numeric key": encodeBase64("yesterday|1"),
+	}
+	for name, cursor := range cursors {
+		if _, err := ListPosts(PostQuery{Sort: SortTop, Before: cursor}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: got %v, want ErrInvalidCursor", name, err)
+		}
+	}
+	// The active sort has a text key, which any string is
+	if _, err := ListPosts(PostQuery{Sort: SortActive, After: encodeBase64("2024-01-01 12:00:00|1")}); err != nil {
+		t.Errorf("text cursor: %v", err)
+	}
+}
+
+// Deleted and hidden replies don't keep a thread at the top of the active
+// sort.
+func TestListPostsActiveIgnoresRemovedComments(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "user")
+	deleted, hidden, plain := createTestPost(t, user), createTestPost(t, user), createTestPost(t, user)
+	if _, err := db.Exec("UPDATE posts SET created_at = ?", sqlTime(time.Now().Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE posts SET created_at = ? WHERE id = ?", sqlTime(time.Now().Add(-time.Minute)), plain); err != nil {
+		t.Fatal(err)
+	}
+	for _, postID := range []int{deleted, hidden} {
+		commentID, err := CreateComment(user, strconv.Itoa(postID), "latest reply", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if postID == deleted {
+			err = DeleteComment(commentID, user)
+		} else {
+			_, err = db.Exec("UPDATE comments SET hidden_at = ? WHERE id = ?", sqlTime(time.Now()), commentID)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := ListPosts(PostQuery{Sort: SortActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := postIDs(page.Posts); len(got) != 3 || got[0] != plain {
+		t.Errorf("active order %v, want %d first", got, plain)
+	}
+}
+
+func encodeBase64(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func postIDs(posts []Post) []int {
+	ids := []int{}
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	return ids
+}
+
+func concat(pages [][]int) []int {
+	all := []int{}
+	for _, page := range pages {
+		all = append(all, page...)
+	}
+	return all
+}
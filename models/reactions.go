@@ -0,0 +1,161 @@
+package models
+
+import "time"
+
+// The reactions behind the score of a post or comment. Every reaction set
+// includes them; the others are only counted.
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+// Reactions counts the reactions to a post or comment.
+type Reactions struct {
+	Likes    int
+	Dislikes int
+	Counts   map[string]int // by reaction type, likes and dislikes included
+	Mine     string         // the viewing user's reaction; empty if none
+}
+
+// Statements that recompute the stored score of the post or comment a
+// reaction changed. Recomputing instead of adding a delta keeps the score
+// right even if it ever drifted. They touch no row when the post is gone or
+// the comment is deleted, or while either is hidden.
+const (
+	scoreOf = `(SELECT COALESCE(SUM(CASE type WHEN 'like' THEN 1 WHEN 'dislike' THEN -1 ELSE 0 END), 0)
+		FROM reactions WHERE target = ? AND target_id = ?)`
+	refreshPostScore    = `UPDATE posts SET score = ` + scoreOf + ` WHERE id = ? AND hidden_at IS NULL`
+	refreshCommentScore = `UPDATE comments SET score = ` + scoreOf + ` WHERE id = ? AND deleted_at IS NULL AND hidden_at IS NULL`
+)
+
+// reactionTarget is what a reaction can be given to: a post or a comment.
+type reactionTarget struct {
+	name     string // the reactions.target value
+	refresh  string // recomputes the target's score
+	notFound error
+}
+
+var (
+	postReactions    = reactionTarget{"post", refreshPostScore, ErrPostNotFound}
+	commentReactions = reactionTarget{"comment", refreshCommentScore, ErrCommentNotFound}
+)
+
+// SetReaction sets userID's reaction to a post to kind, replacing any other
+// reaction of theirs; an empty kind takes the reaction back. Callers check
+// kind against the configured reaction set.
+func SetReaction(postID, userID int, kind string) error {
+	return postReactions.set(postID, userID, kind, false)
+}
+
+// ToggleReaction is the reaction buttons: it sets the reaction to kind, or
+// takes it back if it already is kind.
+func ToggleReaction(postID, userID int, kind string) error {
+	return postReactions.set(postID, userID, kind, true)
+}
+
+// SetCommentReaction is SetReaction for comments. Deleted comments can't be
+// reacted to.
+func SetCommentReaction(commentID, userID int, kind string) error {
+	return commentReactions.set(commentID, userID, kind, false)
+}
+
+// ToggleCommentReaction is ToggleReaction for comments.
+func ToggleCommentReaction(commentID, userID int, kind string) error {
+	return commentReactions.set(commentID, userID, kind, true)
+}
+
+// set writes a reaction with an upsert on the (target, user) unique key and
+// refreshes the target's score in the same transaction. Every statement is a
+// write, so concurrent calls queue for the write lock instead of reading a
+// state another call is about to change.
+func (t reactionTarget) set(id, userID int, kind string, toggle bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if kind == "" {
+		_, err = tx.Exec("DELETE FROM reactions WHERE target = ? AND target_id = ? AND user_id = ?", t.name, id, userID)
+	} else {
+		update := "excluded.type"
+		if toggle {
+			// Pressing the same button again leaves '', which is deleted below.
+			update = "CASE WHEN type = excluded.type THEN '' ELSE excluded.type END"
+		}
+		_, err = tx.Exec(`INSERT INTO reactions (target, target_id, user_id, type, created_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(target, target_id, user_id) DO UPDATE SET type = `+update+`, created_at = excluded.created_at`,
+			t.name, id, userID, kind, sqlTime(time.Now()))
+		if err == nil && toggle {
+			_, err = tx.Exec("DELETE FROM reactions WHERE target = ? AND target_id = ? AND user_id = ? AND type = ''", t.name, id, userID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(t.refresh, t.name, id, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return t.notFound
+	}
+	return tx.Commit()
+}
+
+// GetPostReactions returns the reaction counts of a post and of each of its
+// live comments in one query, along with the reactions of userID (0 for
+// nobody). Comments without reactions are left out of the map; their zero
+// value is the right answer.
+func GetPostReactions(postID string, userID int) (Reactions, map[int]Reactions, error) {
+	rows, err := db.Query(`
+		SELECT 0, type, COUNT(*), MAX(user_id = ?)
+		FROM reactions WHERE target = 'post' AND target_id = ?
+		GROUP BY type
+		UNION ALL
+		SELECT r.target_id, r.type, COUNT(*), MAX(r.user_id = ?)
+		FROM reactions r JOIN comments c ON c.id = r.target_id
+		WHERE r.target = 'comment' AND c.post_id = ? AND c.deleted_at IS NULL
+		GROUP BY r.target_id, r.type`, userID, postID, userID, postID)
+	if err != nil {
+		return Reactions{}, nil, err
+	}
+	defer rows.Close()
+
+	// Post rows come back under comment ID 0.
+	reactions := make(map[int]Reactions)
+	for rows.Next() {
+		var commentID, n int
+		var kind string
+		var mine bool
+		if err := rows.Scan(&commentID, &kind, &n, &mine); err != nil {
+			return Reactions{}, nil, err
+		}
+		r := reactions[commentID]
+		r.add(kind, n, mine)
+		reactions[commentID] = r
+	}
+	if err := rows.Err(); err != nil {
+		return Reactions{}, nil, err
+	}
+	post := reactions[0]
+	delete(reactions, 0)
+	return post, reactions, nil
+}
+
+func (r *Reactions) add(kind string, n int, mine bool) {
+	if r.Counts == nil {
+		r.Counts = make(map[string]int)
+	}
+	r.Counts[kind] = n
+	switch kind {
+	case ReactionLike:
+		r.Likes = n
+	case ReactionDislike:
+		r.Dislikes = n
+	}
+	if mine {
+		r.Mine = kind
+	}
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSetReaction(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	reader := createTestUser(t, "reader")
+	postID := createTestPost(t, author)
+
+	steps := []struct {
+		kind      string
+		toggle    bool
+		wantRows  int
+		wantScore int
+	}{
+		{kind: ReactionLike, wantRows: 1, wantScore: 1},
+		{kind: ReactionLike, wantRows: 1, wantScore: 1}, // setting it again changes nothing
+		{kind: ReactionDislike, wantRows: 1, wantScore: -1},
+		{kind: "love", wantRows: 1, wantScore: 0}, // replaces the dislike
+		{kind: "", wantRows: 0, wantScore: 0},
+		{kind: ReactionLike, toggle: true, wantRows: 1, wantScore: 1},
+		{kind: ReactionDislike, toggle: true, wantRows: 1, wantScore: -1},
+		{kind: ReactionDislike, toggle: true, wantRows: 0, wantScore: 0}, // pressing dislike again takes it back
+	}
+	for i, step := range steps {
+		var err error
+		if step.toggle {
+			err = ToggleReaction(postID, reader, step.kind)
+		} else {
+			err = SetReaction(postID, reader, step.kind)
+		}
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if n := count(t, "SELECT COUNT(*) FROM reactions WHERE target = 'post' AND target_id = ?", postID); n != step.wantRows {
+			t.Errorf("step %d: %d rows, want %d", i, n, step.wantRows)
+		}
+		if n := count(t, "SELECT score FROM posts WHERE id = ?", postID); n != step.wantScore {
+			t.Errorf("step %d: score %d, want %d", i, n, step.wantScore)
+		}
+	}
+
+	if err := SetReaction(postID+1, reader, ReactionLike); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("missing post: got %v, want ErrPostNotFound", err)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM reactions"); n != 0 {
+		t.Errorf("%d rows left by failed reactions", n)
+	}
+
+	commentID, err := CreateComment(author, strconv.Itoa(postID), "a comment", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCommentReaction(commentID, reader, ReactionLike); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteComment(commentID, author); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetCommentReaction(commentID, reader, ReactionDislike); !errors.Is(err, ErrCommentNotFound) {
+		t.Errorf("deleted comment: got %v, want ErrCommentNotFound", err)
+	}
+}
+
+// TestReactionsConcurrent hammers one post and one comment from many
+// goroutines, including several at once for the same user, and checks that
+// no duplicate rows appear and the stored scores match the rows.
+func TestReactionsConcurrent(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	postID := createTestPost(t, author)
+	commentID, err := CreateComment(author, strconv.Itoa(postID), "a comment", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const users = 10
+	const clicks = 8 // per user, all at once
+	var userIDs []int
+	for i := 0; i < users; i++ {
+		userIDs = append(userIDs, createTestUser(t, "user"+strconv.Itoa(i)))
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, users*clicks*2)
+	for i, userID := range userIDs {
+		// Even users end up liking, odd users disliking: SetReaction is
+		// idempotent, so any interleaving gives the same result.
+		kind := ReactionLike
+		if i%2 == 1 {
+			kind = ReactionDislike
+		}
+		for c := 0; c < clicks; c++ {
+			wg.Add(2)
+			go func(userID int) {
+				defer wg.Done()
+				errs <- SetReaction(postID, userID, kind)
+			}(userID)
+			go func(userID int) {
+				defer wg.Done()
+				errs <- SetCommentReaction(commentID, userID, kind)
+			}(userID)
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := count(t, "SELECT COUNT(*) FROM reactions WHERE target = 'post' AND target_id = ?", postID); n != users {
+		t.Errorf("post has %d reaction rows, want %d", n, users)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM reactions WHERE target = 'comment' AND target_id = ?", commentID); n != users {
+		t.Errorf("comment has %d reaction rows, want %d", n, users)
+	}
+	post, comments, err := GetPostReactions(strconv.Itoa(postID), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, r := range map[string]Reactions{"post": post, "comment": comments[commentID]} {
+		if r.Likes != users/2 || r.Dislikes != users/2 {
+			t.Errorf("%s counts %+v, want %d likes and dislikes", name, r, users/2)
+		}
+	}
+	if n := count(t, "SELECT score FROM posts WHERE id = ?", postID); n != 0 {
+		t.Errorf("post score %d, want 0", n)
+	}
+	if n := count(t, "SELECT score FROM comments WHERE id = ?", commentID); n != 0 {
+		t.Errorf("comment score %d, want 0", n)
+	}
+
+	// Toggling is not idempotent, but an even number of concurrent presses
+	// of the same button must still leave no reaction at all.
+	for c := 0; c < clicks; c++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ToggleReaction(postID, author, ReactionLike); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := count(t, "SELECT COUNT(*) FROM reactions WHERE target_id = ? AND user_id = ?", postID, author); n != 0 {
+		t.Errorf("author has %d reactions after %d toggles, want 0", n, clicks)
+	}
+}
+
+func TestGetPostReactions(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	postID := createTestPost(t, author)
+	id := strconv.Itoa(postID)
+	commentID, err := CreateComment(author, id, "a comment", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deletedID, err := CreateComment(author, id, "deleted later", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reactions := []struct {
+		set    func(id, userID int, kind string) error
+		target int
+		user   int
+		kind   string
+	}{
+		{SetReaction, postID, alice, "love"},
+		{SetReaction, postID, bob, "love"},
+		{SetReaction, postID, author, ReactionLike},
+		{SetCommentReaction, commentID, alice, "laugh"},
+		{SetCommentReaction, commentID, bob, ReactionDislike},
+		{SetCommentReaction, deletedID, bob, "wow"},
+	}
+	for _, r := range reactions {
+		if err := r.set(r.target, r.user, r.kind); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := DeleteComment(deletedID, author); err != nil {
+		t.Fatal(err)
+	}
+
+	post, comments, err := GetPostReactions(id, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Counts["love"] != 2 || post.Likes != 1 || post.Dislikes != 0 || post.Mine != "love" {
+		t.Errorf("post reactions %+v", post)
+	}
+	comment := comments[commentID]
+	if comment.Counts["laugh"] != 1 || comment.Dislikes != 1 || comment.Mine != "laugh" {
+		t.Errorf("comment reactions %+v", comment)
+	}
+	if _, ok := comments[deletedID]; ok {
+		t.Errorf("deleted comment has reactions %+v", comments[deletedID])
+	}
+	if n := count(t, "SELECT score FROM comments WHERE id = ?", commentID); n != -1 {
+		t.Errorf("comment score %d, want -1", n)
+	}
+
+	post, _, err = GetPostReactions(id, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Mine != "" {
+		t.Errorf("anonymous viewer has reaction %q", post.Mine)
+	}
+}
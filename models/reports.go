@@ -0,0 +1,300 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How a moderator closes the reports on a post or comment.
+const (
+	ReportResolved  = "resolved"  // the report was right; the moderator dealt with the content
+	ReportDismissed = "dismissed" // the content is fine
+)
+
+var ErrAlreadyReported = errors.New("you already reported this")
+var ErrReportReasonRequired = errors.New("reports need a reason")
+var ErrNoOpenReports = errors.New("no open reports")
+
+// Report is one user's report of a post or comment.
+type Report struct {
+	ID         int
+	ReporterID int
+	Reporter   string // username of the reporter
+	Reason     string
+	CreatedAt  time.Time
+}
+
+// ReportedItem is a post or comment in the moderation queue with its open
+// reports.
+type ReportedItem struct {
+	Target   string // "post" or "comment"
+	TargetID int
+	PostID   int    // the post, or the post the comment is on; 0 once the post is deleted
+	Title    string // title of the post
+	Content  string // text of the post or comment
+	Author   string
+	Hidden   bool
+	Deleted  bool
+	Reports  []Report // oldest first
+}
+
+// reportTarget is what can be reported: a post or a comment.
+type reportTarget struct {
+	name       string // the reports.target value
+	table      string
+	visible    string // condition on table for rows members can see and report
+	hideAction string
+	notFound   error
+}
+
+var (
+	postReports    = reportTarget{"post", "posts", "hidden_at IS NULL", ActionHidePost, ErrPostNotFound}
+	commentReports = reportTarget{"comment", "comments", "hidden_at IS NULL AND deleted_at IS NULL", ActionHideComment, ErrCommentNotFound}
+)
+
+// ReportPost files a report of a post. Once threshold distinct users have
+// open reports on it, the post is hidden until a moderator looks at it; a
+// threshold of 0 turns that off. It reports whether the post got hidden.
+func ReportPost(reporterID, postID int, reason string, threshold int) (bool, error) {
+	return fileReport(postReports, postID, reporterID, reason, threshold)
+}
+
+// ReportComment is ReportPost for comments. Deleted comments can't be
+// reported.
+func ReportComment(reporterID, commentID int, reason string, threshold int) (bool, error) {
+	return fileReport(commentReports, commentID, reporterID, reason, threshold)
+}
+
+func fileReport(target reportTarget, targetID, reporterID int, reason string, threshold int) (bool, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return false, ErrReportReasonRequired
+	}
+	if err := validateReason(reason); err != nil {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Hidden content can't be seen, so it can't be reported either
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM " + target.table + " WHERE id = ? AND " + target.visible + ")"
+	if err := tx.QueryRow(query, targetID).Scan(&exists); err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, target.notFound
+	}
+
+	res, err := tx.Exec(`INSERT INTO reports (target, target_id, reporter_id, reason, created_at)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		target.name, targetID, reporterID, reason, sqlTime(time.Now()))
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, ErrAlreadyReported
+	}
+
+	hidden := false
+	if threshold > 0 {
+		var reporters int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM reports WHERE target = ? AND target_id = ? AND resolved_at IS NULL",
+			target.name, targetID).Scan(&reporters); err != nil {
+			return false, err
+		}
+		if reporters >= threshold {
+			if _, err := setFlag(tx, target.table, "hidden_at", true, targetID); err != nil {
+				return false, err
+			}
+			entry := ModAction{Action: target.hideAction, Target: target.name, TargetID: targetID,
+				Reason: fmt.Sprintf("reported by %d users", reporters)}
+			if err := logModAction(tx, entry); err != nil {
+				return false, err
+			}
+			hidden = true
+		}
+	}
+	return hidden, tx.Commit()
+}
+
+// GetReportQueue lists the posts and comments with open reports, the most
+// reported first.
+func GetReportQueue() ([]ReportedItem, error) {
+	rows, err := db.Query(`
+		SELECT r.target, r.target_id, COALESCE(p.id, c.post_id, 0), COALESCE(p.title, cp.title, ''),
+			COALESCE(p.content, c.comment, ''), COALESCE(p.Author, c.Author, ''),
+			COALESCE(p.hidden_at, c.hidden_at) IS NOT NULL,
+			(p.id IS NULL AND c.id IS NULL) OR c.deleted_at IS NOT NULL
+		FROM reports r
+		LEFT JOIN posts p ON r.target = 'post' AND p.id = r.target_id
+		LEFT JOIN comments c ON r.target = 'comment' AND c.id = r.target_id
+		LEFT JOIN posts cp ON cp.id = c.post_id
+		WHERE r.resolved_at IS NULL
+		GROUP BY r.target, r.target_id
+		ORDER BY COUNT(*) DESC, MIN(r.id)`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []ReportedItem
+	index := make(map[string]int)
+	for rows.Next() {
+		var item ReportedItem
+		if err := rows.Scan(&item.Target, &item.TargetID, &item.PostID, &item.Title, &item.Content, &item.Author,
+			&item.Hidden, &item.Deleted); err != nil {
+			return nil, err
+		}
+		index[item.Target+strconv.Itoa(item.TargetID)] = len(items)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT r.id, r.target, r.target_id, r.reporter_id, u.username, r.reason, r.created_at
+		FROM reports r JOIN users u ON u.id = r.reporter_id
+		WHERE r.resolved_at IS NULL ORDER BY r.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var report Report
+		var target string
+		var targetID int
+		if err := rows.Scan(&report.ID, &target, &targetID, &report.ReporterID, &report.Reporter, &report.Reason, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		if i, ok := index[target+strconv.Itoa(targetID)]; ok {
+			items[i].Reports = append(items[i].Reports, report)
+		}
+	}
+	return items, rows.Err()
+}
+
+// ResolveReports closes the open reports on a post or comment ("post" or
+// "comment") as resolved or dismissed and tells every reporter the outcome,
+// with the moderator's note. Dismissing also brings back content that was
+// hidden automatically by reports.
+func ResolveReports(actorID int, target string, targetID int, resolution, note string) error {
+	var t reportTarget
+	switch target {
+	case postReports.name:
+		t = postReports
+	case commentReports.name:
+		t = commentReports
+	default:
+		return ErrInvalidAction
+	}
+	var action string
+	switch resolution {
+	case ReportResolved:
+		action = ActionResolveReports
+	case ReportDismissed:
+		action = ActionDismissReports
+	default:
+		return ErrInvalidAction
+	}
+
+	entry := ModAction{Action: action, Target: t.name, TargetID: targetID, Reason: note}
+	return moderate(actorID, RoleModerator, entry, func(tx *sql.Tx) (string, error) {
+		rows, err := tx.Query("SELECT reporter_id FROM reports WHERE target = ? AND target_id = ? AND resolved_at IS NULL",
+			t.name, targetID)
+		if err != nil {
+			return "", err
+		}
+		var reporters []int
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return "", err
+			}
+			reporters = append(reporters, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		if len(reporters) == 0 {
+			return "", ErrNoOpenReports
+		}
+
+		if _, err := tx.Exec(`UPDATE reports SET resolved_at = ?, resolution = ?, resolver_id = ?
+			WHERE target = ? AND target_id = ? AND resolved_at IS NULL`,
+			sqlTime(time.Now()), resolution, actorID, t.name, targetID); err != nil {
+			return "", err
+		}
+		if resolution == ReportDismissed {
+			if err := unhideIfAutoHidden(tx, t, targetID); err != nil {
+				return "", err
+			}
+		}
+
+		what, link, err := describeTarget(tx, t, targetID)
+		if err != nil {
+			return "", err
+		}
+		message := fmt.Sprintf("Your report of %s was %s by a moderator: %s", what, resolution, strings.TrimSpace(note))
+		for _, reporter := range reporters {
+			if err := notify(tx, reporter, message, link); err != nil {
+				return "", err
+			}
+		}
+		return fmt.Sprintf("%d reports", len(reporters)), nil
+	})
+}
+
+// unhideIfAutoHidden unhides a target whose last hide or unhide came from
+// the report threshold rather than a moderator.
+func unhideIfAutoHidden(tx *sql.Tx, t reportTarget, targetID int) error {
+	var action string
+	var automatic bool
+	err := tx.QueryRow(`SELECT action, actor_id IS NULL FROM mod_actions
+		WHERE target = ? AND target_id = ? AND action IN (?, ?, ?, ?)
+		ORDER BY id DESC LIMIT 1`,
+		t.name, targetID, ActionHidePost, ActionUnhidePost, ActionHideComment, ActionUnhideComment).Scan(&action, &automatic)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if action != t.hideAction || !automatic {
+		return nil
+	}
+	_, err = setFlag(tx, t.table, "hidden_at", false, targetID)
+	return err
+}
+
+// describeTarget names a reported post or comment for a notification and
+// links to it if it still exists.
+func describeTarget(tx *sql.Tx, t reportTarget, targetID int) (string, string, error) {
+	query := "SELECT id, title FROM posts WHERE id = ?"
+	if t == commentReports {
+		query = "SELECT p.id, p.title FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.id = ?"
+	}
+	var postID int
+	var title string
+	err := tx.QueryRow(query, targetID).Scan(&postID, &title)
+	if err == sql.ErrNoRows {
+		return "a deleted " + t.name, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	link := "/Post?id=" + strconv.Itoa(postID)
+	if t == commentReports {
+		return fmt.Sprintf("a comment on %q", title), link + "#comment-" + strconv.Itoa(targetID), nil
+	}
+	return fmt.Sprintf("the post %q", title), link, nil
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestReportThreshold(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	postID := createTestPost(t, author)
+	var reporters []int
+	for i := 0; i < 3; i++ {
+		reporters = append(reporters, createTestUser(t, "reporter"+strconv.Itoa(i)))
+	}
+
+	if _, err := ReportPost(reporters[0], postID, " ", 2); !errors.Is(err, ErrReportReasonRequired) {
+		t.Errorf("no reason: got %v, want ErrReportReasonRequired", err)
+	}
+	var invalid ValidationError
+	if _, err := ReportPost(reporters[0], postID, strings.Repeat("é", MaxReasonLength+1), 2); !errors.As(err, &invalid) || invalid["reason"] == "" {
+		t.Errorf("long reason: got %v, want a reason ValidationError", err)
+	}
+	if _, err := ReportPost(reporters[0], postID+1, "spam", 2); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("missing post: got %v, want ErrPostNotFound", err)
+	}
+
+	hidden, err := ReportPost(reporters[0], postID, "spam", 2)
+	if err != nil || hidden {
+		t.Fatalf("first report: hidden %v, %v", hidden, err)
+	}
+	// The same user reporting again doesn't count twice
+	if _, err := ReportPost(reporters[0], postID, "really spam", 2); !errors.Is(err, ErrAlreadyReported) {
+		t.Errorf("second report by the same user: got %v, want ErrAlreadyReported", err)
+	}
+	hidden, err = ReportPost(reporters[1], postID, "ads", 2)
+	if err != nil || !hidden {
+		t.Fatalf("report reaching the threshold: hidden %v, %v", hidden, err)
+	}
+	post, err := GetPostByID(strconv.Itoa(postID))
+	if err != nil || !post.Hidden {
+		t.Fatalf("post not hidden: %+v, %v", post, err)
+	}
+	if _, err := ReportPost(reporters[2], postID, "spam", 2); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("reporting a hidden post: got %v, want ErrPostNotFound", err)
+	}
+
+	actions, err := GetModActions(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actions[0].Action != ActionHidePost || actions[0].ActorID != 0 {
+		t.Errorf("automatic hide logged as %+v", actions[0])
+	}
+
+	queue, err := GetReportQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || len(queue[0].Reports) != 2 || !queue[0].Hidden || queue[0].Reports[0].Reason != "spam" {
+		t.Fatalf("queue: %+v", queue)
+	}
+}
+
+func TestResolveReports(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "author")
+	mod := createTestUser(t, "mod")
+	reporter := createTestUser(t, "reporter")
+	other := createTestUser(t, "other")
+	if err := SetUserRoleByName("mod", RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	postID := createTestPost(t, author)
+	commentID, err := CreateComment(author, strconv.Itoa(postID), "rude", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []int{reporter, other} {
+		if _, err := ReportComment(user, commentID, "rude", 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ReportPost(reporter, postID, "off topic", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	queue, err := GetReportQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 2 || queue[0].Target != "comment" || queue[1].Target != "post" {
+		t.Fatalf("queue not sorted by report count: %+v", queue)
+	}
+
+	if err := ResolveReports(reporter, "comment", commentID, ReportDismissed, "fine"); !errors.Is(err, ErrNotModerator) {
+		t.Errorf("member resolving: got %v, want ErrNotModerator", err)
+	}
+	if err := ResolveReports(mod, "comment", commentID, "ignored", "fine"); !errors.Is(err, ErrInvalidAction) {
+		t.Errorf("unknown resolution: got %v, want ErrInvalidAction", err)
+	}
+
+	// Dismissing brings back the automatically hidden comment
+	if err := ResolveReports(mod, "comment", commentID, ReportDismissed, "just blunt"); err != nil {
+		t.Fatal(err)
+	}
+	comment, err := GetCommentByID(commentID)
+	if err != nil || comment.Hidden {
+		t.Errorf("dismissed comment still hidden: %+v, %v", comment, err)
+	}
+	if err := ResolveReports(mod, "comment", commentID, ReportDismissed, "again"); !errors.Is(err, ErrNoOpenReports) {
+		t.Errorf("resolving twice: got %v, want ErrNoOpenReports", err)
+	}
+
+	// A moderator's own hide survives a dismissal
+	if err := ModeratePost(mod, postID, ActionHidePost, "off topic"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ResolveReports(mod, "post", postID, ReportResolved, "hidden"); err != nil {
+		t.Fatal(err)
+	}
+	post, err := GetPostByID(strconv.Itoa(postID))
+	if err != nil || !post.Hidden {
+		t.Errorf("resolved post: %+v, %v", post, err)
+	}
+
+	notifications, err := GetNotifications(reporter, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(notifications) != 2 {
+		t.Fatalf("%d notifications, want 2: %+v", len(notifications), notifications)
+	}
+	if !strings.Contains(notifications[0].Message, "resolved") || !strings.Contains(notifications[1].Message, "dismissed") {
+		t.Errorf("notifications: %+v", notifications)
+	}
+	if n, err := CountUnreadNotifications(reporter); err != nil || n != 2 {
+		t.Errorf("unread: %d, %v", n, err)
+	}
+	if err := MarkNotificationsRead(reporter); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := CountUnreadNotifications(reporter); err != nil || n != 0 {
+		t.Errorf("unread after marking read: %d, %v", n, err)
+	}
+	if n, err := CountUnreadNotifications(other); err != nil || n != 1 {
+		t.Errorf("other reporter: %d unread, %v", n, err)
+	}
+
+	if queue, err := GetReportQueue(); err != nil || len(queue) != 0 {
+		t.Errorf("queue after resolving: %+v, %v", queue, err)
+	}
+}
@@ -0,0 +1,179 @@
+package models
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Snippets returned by Search wrap matched words in these markers. Posts and
+// comments are stored without control characters (see cleanText), so the
+// markers only come from Search and callers can escape the text and then
+// swap them for real highlighting.
+const (
+	HighlightStart = "\x02"
+	HighlightEnd   = "\x03"
+)
+
+// SearchResultLimit caps the number of results Search returns.
+const SearchResultLimit = 50
+
+// SearchQuery is a parsed search box input.
+type SearchQuery struct {
+	Match    string // FTS5 match expression; empty when only filters were given
+	Author   string // author:name filter
+	Category string // category:name filter
+}
+
+// SearchResult is a post or comment matching a search.
+type SearchResult struct {
+	Kind      string // "post" or "comment"
+	PostID    int
+	CommentID int // 0 for posts
+	Title     string
+	Author    string
+	Snippet   string // excerpt with HighlightStart/HighlightEnd around matches
+}
+
+// ParseSearchQuery splits the search box input into words, "quoted phrases"
+// and author:/category: filters. Filter values may be quoted too. Every word
+// and phrase is quoted for FTS5, so operators and stray punctuation in the
+// input are searched for literally instead of causing syntax errors; a
+// trailing * on a word still does a prefix search.
+func ParseSearchQuery(input string) SearchQuery {
+	var q SearchQuery
+	var terms []string
+	for _, token := range splitSearchInput(input) {
+		switch {
+		case token.filter == "author":
+			q.Author = token.text
+		case token.filter == "category":
+			q.Category = token.text
+		case token.phrase:
+			if strings.TrimSpace(token.text) != "" {
+				terms = append(terms, `"`+token.text+`"`)
+			}
+		default:
+			word := strings.TrimRight(token.text, "*")
+			if word == "" {
+				continue
+			}
+			term := `"` + word + `"`
+			if len(word) < len(token.text) {
+				term += "*"
+			}
+			terms = append(terms, term)
+		}
+	}
+	q.Match = strings.Join(terms, " ")
+	return q
+}
+
+type searchToken struct {
+	text   string
+	phrase bool   // the text was in double quotes
+	filter string // "author" or "category" for filter:value tokens
+}
+
+// splitSearchInput breaks the input at spaces, keeping quoted text together.
+// Double quotes never end up inside a token's text.
+func splitSearchInput(input string) []searchToken {
+	var tokens []searchToken
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+
+		var token searchToken
+		// filter:value or filter:"quoted value"
+		for _, filter := range []string{"author", "category"} {
+			prefix := []rune(filter + ":")
+			if len(runes)-i > len(prefix) && strings.EqualFold(string(runes[i:i+len(prefix)]), string(prefix)) {
+				token.filter = filter
+				i += len(prefix)
+				break
+			}
+		}
+
+		if runes[i] == '"' {
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			token.text = string(runes[i+1 : end])
+			token.phrase = token.filter == ""
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) {
+				end++
+			}
+			token.text = strings.ReplaceAll(string(runes[i:end]), `"`, "")
+			i = end
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// Search finds posts and comments matching q, best matches first as ranked by
+// bm25 (title hits weigh more than body hits). With no search words it lists
+// the newest posts and comments that pass the filters.
+func Search(q SearchQuery) ([]SearchResult, error) {
+	var where []string
+	var args []interface{}
+	if q.Match != "" {
+		where = append(where, "search_index MATCH ?")
+		args = append(args, q.Match)
+	}
+	if q.Author != "" {
+		where = append(where, "s.author = ? COLLATE NOCASE")
+		args = append(args, q.Author)
+	}
+	if q.Category != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM post_categories pc JOIN categories c ON c.id = pc.category_id
+			WHERE pc.post_id = s.post_id AND c.name = ? COLLATE NOCASE)`)
+		args = append(args, q.Category)
+	}
+	if len(where) == 0 {
+		return nil, nil
+	}
+	// Leave out whatever moderators hid. Comments sit at odd rowids, see
+	// the search_index triggers.
+	where = append(where, "p.hidden_at IS NULL", `(s.kind = 'post' OR NOT EXISTS (
+		SELECT 1 FROM comments c WHERE c.id = (s.rowid - 1) / 2 AND c.hidden_at IS NOT NULL))`)
+
+	snippet := "substr(s.body, 1, 200)"
+	order := "s.rowid DESC"
+	if q.Match != "" {
+		snippet = "snippet(search_index, -1, '" + HighlightStart + "', '" + HighlightEnd + "', '…', 24)"
+		order = "bm25(search_index, 10.0, 1.0)"
+	}
+
+	rows, err := db.Query(`
+		SELECT s.kind, s.post_id, s.rowid, p.title, s.author, `+snippet+`
+		FROM search_index s
+		JOIN posts p ON p.id = s.post_id
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY `+order+`
+		LIMIT ?`, append(args, SearchResultLimit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var result SearchResult
+		var rowID int
+		if err := rows.Scan(&result.Kind, &result.PostID, &rowID, &result.Title, &result.Author, &result.Snippet); err != nil {
+			return nil, err
+		}
+		if result.Kind == "comment" {
+			result.CommentID = (rowID - 1) / 2
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
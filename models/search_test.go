@@ -0,0 +1,161 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		input string
+		want  SearchQuery
+	}{
+		{"go forum", SearchQuery{Match: `"go" "forum"`}},
+		{`"hello world" go`, SearchQuery{Match: `"hello world" "go"`}},
+		{"gopher*", SearchQuery{Match: `"gopher"*`}},
+		{"*** \"\"", SearchQuery{}},
+		// Operators, column filters and stray quotes are searched for
+		// literally
+		{"NOT go OR rust", SearchQuery{Match: `"NOT" "go" "OR" "rust"`}},
+		{"title:go (x", SearchQuery{Match: `"title:go" "(x"`}},
+		{`say"cheese`, SearchQuery{Match: `"saycheese"`}},
+		{`"unclosed phrase`, SearchQuery{Match: `"unclosed phrase"`}},
+		{`author:bob Category:"General Talk" go`, SearchQuery{Match: `"go"`, Author: "bob", Category: "General Talk"}},
+		{"author:", SearchQuery{Match: `"author:"`}},
+	}
+	for _, tt := range tests {
+		if got := ParseSearchQuery(tt.input); got != tt.want {
+			t.Errorf("ParseSearchQuery(%q) = %+v, want %+v", tt.input, got, tt.want)
+		}
+	}
+}
+
+// search runs input through ParseSearchQuery and Search.
+func search(t *testing.T, input string) []SearchResult {
+	t.Helper()
+	results, err := Search(ParseSearchQuery(input))
+	if err != nil {
+		t.Fatalf("searching %q: %v", input, err)
+	}
+	return results
+}
+
+func TestSearch(t *testing.T) {
+	setupTestDB(t)
+	alice := createTestUser(t, "alice")
+	bob := createTestUser(t, "bob")
+	postID, err := CreatePost(alice, "Gophers", "A talk about concurrency", []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := CreateComment(bob, strconv.Itoa(postID), "I love channels", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Posts sit at even rowids and comments at odd ones
+	if n := count(t, "SELECT COUNT(*) FROM search_index WHERE rowid = ? AND kind = 'post'", 2*postID); n != 1 {
+		t.Errorf("post indexed %d times at rowid %d", n, 2*postID)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM search_index WHERE rowid = ? AND kind = 'comment'", 2*commentID+1); n != 1 {
+		t.Errorf("comment indexed %d times at rowid %d", n, 2*commentID+1)
+	}
+	results := search(t, "channels")
+	if len(results) != 1 || results[0].Kind != "comment" || results[0].CommentID != commentID || results[0].PostID != postID {
+		t.Fatalf("comment search: %+v", results)
+	}
+	if !strings.Contains(results[0].Snippet, HighlightStart+"channels"+HighlightEnd) {
+		t.Errorf("snippet %q doesn't mark the match", results[0].Snippet)
+	}
+	if results := search(t, "gopher*"); len(results) != 1 || results[0].Kind != "post" || results[0].CommentID != 0 {
+		t.Errorf("post search: %+v", results)
+	}
+	if results := search(t, "author:bob"); len(results) != 1 || results[0].CommentID != commentID {
+		t.Errorf("author filter: %+v", results)
+	}
+	if results := search(t, "category:general"); len(results) != 2 {
+		t.Errorf("category filter: %d results, want 2", len(results))
+	}
+	search(t, `NOT (x OR "`) // must not be an FTS5 syntax error
+
+	// Edits and deletes keep the index up to date
+	if err := UpdatePost(postID, alice, "Rustaceans", "A talk about ownership", []int{1}); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(t, "gophers"); len(results) != 0 {
+		t.Errorf("old title still found: %+v", results)
+	}
+	if results := search(t, "rustaceans"); len(results) != 1 {
+		t.Errorf("new title: %d results, want 1", len(results))
+	}
+	if err := UpdateComment(commentID, bob, "I love borrowing"); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(t, "channels"); len(results) != 0 {
+		t.Errorf("old comment text still found: %+v", results)
+	}
+	if err := DeleteComment(commentID, bob); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(t, "borrowing"); len(results) != 0 {
+		t.Errorf("deleted comment still found: %+v", results)
+	}
+	if err := DeletePost(postID, alice); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM search_index"); n != 0 {
+		t.Errorf("%d index rows left after deleting everything", n)
+	}
+}
+
+func TestSearchLeavesOutHiddenContent(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "user")
+	postID, err := CreatePost(user, "Visible", "zebra", []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	commentID, err := CreateComment(user, strconv.Itoa(postID), "zebra comment", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results := search(t, "zebra"); len(results) != 2 {
+		t.Fatalf("%d results, want 2", len(results))
+	}
+
+	if _, err := db.Exec("UPDATE comments SET hidden_at = ? WHERE id = ?", sqlTime(time.Now()), commentID); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(t, "zebra"); len(results) != 1 || results[0].Kind != "post" {
+		t.Errorf("hidden comment: %+v", results)
+	}
+	if _, err := db.Exec("UPDATE posts SET hidden_at = ? WHERE id = ?", sqlTime(time.Now()), postID); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(t, "zebra"); len(results) != 0 {
+		t.Errorf("hidden post: %+v", results)
+	}
+}
+
+// User text can't smuggle in the snippet markers.
+func TestSearchMarkersNotStored(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "user")
+	postID, err := CreatePost(user, "Fake\x02mark\x03", "zebra\x02 <b>\x03\tand\nmore", []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	post, err := GetPostByID(strconv.Itoa(postID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post.Title != "Fakemark" || post.Content != "zebra <b>\tand\nmore" {
+		t.Errorf("stored %q, %q", post.Title, post.Content)
+	}
+	results := search(t, "zebra")
+	if len(results) != 1 || strings.Count(results[0].Snippet, HighlightStart) != 1 || strings.Count(results[0].Snippet, HighlightEnd) != 1 {
+		t.Errorf("snippet: %+v", results)
+	}
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// sqlTimeLayout matches the format SQLite uses for CURRENT_TIMESTAMP, so
+// stored times compare correctly as strings.
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+// lastSeenResolution limits how often a session's last_seen is rewritten.
+const lastSeenResolution = time.Minute
+
+func sqlTime(t time.Time) string {
+	return t.UTC().Format(sqlTimeLayout)
+}
+
+// SessionKey is what the sessions table stores instead of a session ID, so
+// a copy of the database holds no working session tokens. Lists of sessions
+// name them by it.
+func SessionKey(sessionID string) string {
+	return hashToken(sessionID)
+}
+
+// CreateSession stores a new session. Other sessions of the same user are
+// left alone so several devices can be logged in at once.
+func CreateSession(session Session) error {
+	now := time.Now()
+
+	// Housekeeping: drop anything that has already expired.
+	if _, err := db.Exec("DELETE FROM sessions WHERE expires_at <= ?", sqlTime(now)); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`INSERT INTO sessions (id, user_id, user_agent, ip, created_at, last_seen, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		SessionKey(session.ID), session.UserID, session.UserAgent, session.IP, sqlTime(now), sqlTime(now), sqlTime(session.ExpiresAt))
+	return err
+}
+
+// GetSession returns the ID of the user owning a session that has not
+// expired yet and records that the session was just used. It returns
+// ErrSessionNotFound if there is no such session. Failing to record the use
+// is only logged: the session is still valid.
+func GetSession(sessionID string) (int, error) {
+	now := time.Now()
+	var userID int
+	key := SessionKey(sessionID)
+	err := db.QueryRow("SELECT user_id FROM sessions WHERE id = ? AND expires_at > ?",
+		key, sqlTime(now)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrSessionNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = db.Exec("UPDATE sessions SET last_seen = ? WHERE id = ? AND last_seen < ?",
+		sqlTime(now), key, sqlTime(now.Add(-lastSeenResolution)))
+	if err != nil {
+		log.Printf("Error updating last_seen of a session: %v", err)
+	}
+	return userID, nil
+}
+
+// GetUserSessions lists the live sessions of a user, most recently used
+// first. The sessions have their Key but no ID.
+func GetUserSessions(userID int) ([]Session, error) {
+	var sessions []Session
+	rows, err := db.Query(`SELECT id, user_agent, ip, created_at, last_seen, expires_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen DESC`, userID, sqlTime(time.Now()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		session := Session{UserID: userID}
+		if err := rows.Scan(&session.Key, &session.UserAgent, &session.IP, &session.CreatedAt, &session.LastSeen, &session.ExpiresAt); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession removes a single session.
+func DeleteSession(sessionID string) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE id = ?", SessionKey(sessionID))
+	return err
+}
+
+// DeleteUserSession removes the session of a user with the given key.
+func DeleteUserSession(userID int, key string) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", key, userID)
+	return err
+}
+
+// DeleteUserSessions removes every session of a user.
+func DeleteUserSessions(userID int) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	return err
+}
+
+// DeleteExpiredSessions removes every session past its expiry time.
+func DeleteExpiredSessions() error {
+	_, err := db.Exec("DELETE FROM sessions WHERE expires_at <= ?", sqlTime(time.Now()))
+	return err
+}
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGetSession(t *testing.T) {
+	setupTestDB(t)
+	userID := createTestUser(t, "user")
+	if err := CreateSession(Session{ID: "live", UserID: userID, ExpiresAt: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetSession("live"); err != nil || got != userID {
+		t.Fatalf("GetSession = %d, %v; want %d", got, err, userID)
+	}
+	if _, err := GetSession("unknown"); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("unknown session: got %v, want ErrSessionNotFound", err)
+	}
+	// Only the key is stored, and lists name sessions by it
+	if n := count(t, "SELECT COUNT(*) FROM sessions WHERE id = ?", SessionKey("live")); n != 1 {
+		t.Error("session not stored under its key")
+	}
+	if _, err := GetSession(SessionKey("live")); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("session key used as the ID: got %v, want ErrSessionNotFound", err)
+	}
+	sessions, err := GetUserSessions(userID)
+	if err != nil || len(sessions) != 1 || sessions[0].Key != SessionKey("live") || sessions[0].ID != "" {
+		t.Errorf("GetUserSessions = %+v, %v", sessions, err)
+	}
+
+	// Failing to record the use doesn't log the user out
+	if _, err := db.Exec("UPDATE sessions SET last_seen = ?", sqlTime(time.Now().Add(-time.Hour))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("CREATE TRIGGER no_updates BEFORE UPDATE ON sessions BEGIN SELECT RAISE(FAIL, 'read only'); END"); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := GetSession("live"); err != nil || got != userID {
+		t.Errorf("with last_seen failing: GetSession = %d, %v; want %d", got, err, userID)
+	}
+
+	// Nor does a broken database pass for a missing session
+	if _, err := db.Exec("DROP TABLE sessions"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetSession("live"); err == nil || errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("without a sessions table: got %v, want the query error", err)
+	}
+}
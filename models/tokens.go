@@ -0,0 +1,149 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Personal access token scopes. Each scope includes the ones before it.
+const (
+	ScopeRead     = "read"     // read-only
+	ScopePost     = "post"     // also create, edit, delete and react
+	ScopeModerate = "moderate" // also use moderator tools the user has access to
+)
+
+// TokenScopes lists the scopes in increasing order of power.
+var TokenScopes = []string{ScopeRead, ScopePost, ScopeModerate}
+
+// APITokenPrefix starts every personal access token, which tells them apart
+// from session tokens and makes leaked ones easy to grep for.
+const APITokenPrefix = "fpat_"
+
+var ErrTokenNotFound = errors.New("token not found")
+var ErrInvalidScope = errors.New("invalid token scope")
+
+// APIToken is a personal access token without its secret.
+type APIToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	Scope      string
+	CreatedAt  time.Time
+	LastUsedAt time.Time // zero if the token was never used
+}
+
+// ScopeIncludes reports whether a token with scope has the rights of need.
+func ScopeIncludes(scope, need string) bool {
+	return scopeLevel(scope) >= scopeLevel(need) && scopeLevel(need) > 0
+}
+
+func scopeLevel(scope string) int {
+	for i, s := range TokenScopes {
+		if s == scope {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIToken issues a new personal access token for a user and returns
+// it along with the token itself. Only its hash is stored, so this is the
+// only time the token can be shown.
+func CreateAPIToken(userID int, name, scope string) (*APIToken, string, error) {
+	if scopeLevel(scope) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	token := APITokenPrefix + hex.EncodeToString(secret)
+
+	now := time.Now().Truncate(time.Second)
+	res, err := db.Exec("INSERT INTO api_tokens (user_id, name, token_hash, scope, created_at) VALUES (?, ?, ?, ?, ?)",
+		userID, name, hashToken(token), scope, sqlTime(now))
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, "", err
+	}
+	return &APIToken{ID: int(id), UserID: userID, Name: name, Scope: scope, CreatedAt: now}, token, nil
+}
+
+// GetAPIToken looks up a personal access token and records that it was just
+// used.
+func GetAPIToken(token string) (*APIToken, error) {
+	now := time.Now()
+	hash := hashToken(token)
+	var t APIToken
+	var lastUsed sql.NullTime
+	err := db.QueryRow("SELECT id, user_id, name, scope, created_at, last_used_at FROM api_tokens WHERE token_hash = ?", hash).
+		Scan(&t.ID, &t.UserID, &t.Name, &t.Scope, &t.CreatedAt, &lastUsed)
+	if err == sql.ErrNoRows {
+		return nil, ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.LastUsedAt = lastUsed.Time
+
+	if now.Sub(t.LastUsedAt) >= lastSeenResolution {
+		if _, err := db.Exec("UPDATE api_tokens SET last_used_at = ? WHERE id = ?", sqlTime(now), t.ID); err != nil {
+			return nil, err
+		}
+		t.LastUsedAt = now
+	}
+	return &t, nil
+}
+
+// GetUserAPITokens lists the tokens of a user, newest first.
+func GetUserAPITokens(userID int) ([]APIToken, error) {
+	rows, err := db.Query(`SELECT id, name, scope, created_at, last_used_at
+		FROM api_tokens WHERE user_id = ? ORDER BY id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		t := APIToken{UserID: userID}
+		var lastUsed sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt, &lastUsed); err != nil {
+			return nil, err
+		}
+		t.LastUsedAt = lastUsed.Time
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAPIToken revokes one of a user's tokens.
+func DeleteAPIToken(tokenID, userID int) error {
+	res, err := db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// DeleteUserAPITokens revokes every token of a user, as when their password
+// is reset.
+func DeleteUserAPITokens(userID int) error {
+	_, err := db.Exec("DELETE FROM api_tokens WHERE user_id = ?", userID)
+	return err
+}
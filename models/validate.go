@@ -0,0 +1,151 @@
+package models
+
+import (
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits on what users type in. Lengths count characters, not bytes, except
+// for the password: bcrypt only looks at its first 72 bytes.
+const (
+	MaxEmailLength    = 254
+	MinUsernameLength = 3
+	MaxUsernameLength = 30
+	MinPasswordLength = 8
+	MaxPasswordBytes  = 72
+	MaxTitleLength    = 100
+	MaxPostLength     = 10000
+	MaxCommentLength  = 250
+	MaxReasonLength   = 250 // of a report, or a moderator's reason or note
+)
+
+// ValidationError says what is wrong with user input, as a message per form
+// field.
+type ValidationError map[string]string
+
+func (e ValidationError) Error() string {
+	fields := make([]string, 0, len(e))
+	for field := range e {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	problems := make([]string, len(fields))
+	for i, field := range fields {
+		problems[i] = field + ": " + e[field]
+	}
+	return "invalid input: " + strings.Join(problems, "; ")
+}
+
+// add records the first problem found with field.
+func (e ValidationError) add(field, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+// err returns e if it holds any problems and nil otherwise.
+func (e ValidationError) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// text checks a required free-text field: it must hold more than whitespace
+// and at most max characters.
+func (e ValidationError) text(field, value, name string, max int) {
+	if strings.TrimSpace(value) == "" {
+		e.add(field, name+" can't be empty or only spaces")
+	} else if utf8.RuneCountInString(value) > max {
+		e.add(field, name+" can't be longer than "+strconv.Itoa(max)+" characters")
+	}
+}
+
+// ValidateUser checks the fields of the registration form.
+func ValidateUser(email, username, password string) error {
+	e := ValidationError{}
+
+	if email == "" {
+		e.add("email", "Email is required")
+	} else if len(email) > MaxEmailLength {
+		e.add("email", "Email can't be longer than "+strconv.Itoa(MaxEmailLength)+" characters")
+	} else if address, err := mail.ParseAddress(email); err != nil || address.Address != email || !strings.Contains(email[strings.LastIndex(email, "@"):], ".") {
+		e.add("email", "Enter a valid email address, like name@example.com")
+	}
+
+	switch n := utf8.RuneCountInString(username); {
+	case n < MinUsernameLength || n > MaxUsernameLength:
+		e.add("username", "Username must be "+strconv.Itoa(MinUsernameLength)+" to "+strconv.Itoa(MaxUsernameLength)+" characters")
+	case strings.IndexFunc(username, invalidUsernameRune) >= 0:
+		e.add("username", "Username can only contain letters, digits, '.', '-' and '_'")
+	}
+
+	e.password(password)
+	return e.err()
+}
+
+// ValidatePassword checks a new password, as when resetting one.
+func ValidatePassword(password string) error {
+	e := ValidationError{}
+	e.password(password)
+	return e.err()
+}
+
+func (e ValidationError) password(password string) {
+	switch {
+	case strings.TrimSpace(password) == "":
+		e.add("password", "Password can't be empty or only spaces")
+	case utf8.RuneCountInString(password) < MinPasswordLength:
+		e.add("password", "Password must be at least "+strconv.Itoa(MinPasswordLength)+" characters")
+	case len(password) > MaxPasswordBytes:
+		e.add("password", "Password can't be longer than "+strconv.Itoa(MaxPasswordBytes)+" bytes")
+	}
+}
+
+func invalidUsernameRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '-' && r != '_'
+}
+
+// cleanText drops the control characters other than tabs and line breaks
+// from user text before it is stored. Besides being useless in a post, they
+// would pass for the HighlightStart and HighlightEnd markers of search
+// snippets.
+func cleanText(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// ValidatePost checks the fields of the post form. categoryIDs are the
+// checked categories.
+func ValidatePost(title, content string, categoryIDs []int) error {
+	e := ValidationError{}
+	e.text("title", title, "Title", MaxTitleLength)
+	e.text("content", content, "Content", MaxPostLength)
+	if len(categoryIDs) == 0 {
+		e.add("categories", "Pick at least one category")
+	}
+	return e.err()
+}
+
+// validateReason checks the length of a report reason or a moderator's
+// reason or note. Empty reasons have their own errors.
+func validateReason(reason string) error {
+	e := ValidationError{}
+	e.text("reason", reason, "Reason", MaxReasonLength)
+	return e.err()
+}
+
+// ValidateComment checks the text of a comment.
+func ValidateComment(content string) error {
+	e := ValidationError{}
+	e.text("comment", content, "Comment", MaxCommentLength)
+	return e.err()
+}
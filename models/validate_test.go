@@ -0,0 +1,101 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidateUser(t *testing.T) {
+	tests := []struct {
+		email, username, password string
+		invalid                   []string // fields expected to be refused
+	}{
+		{"alice@example.com", "alice", "password1", nil},
+		{"alice@example.com", "al_ice-2.0", "pässwörd", nil},
+		{"", "alice", "password1", []string{"email"}},
+		{"alice", "alice", "password1", []string{"email"}},
+		{"alice@localhost", "alice", "password1", []string{"email"}},
+		{"Alice <alice@example.com>", "alice", "password1", []string{"email"}},
+		{"alice@example.com", "al", "password1", []string{"username"}},
+		{"alice@example.com", "alice smith", "password1", []string{"username"}},
+		{"alice@example.com", strings.Repeat("a", MaxUsernameLength+1), "password1", []string{"username"}},
+		{"alice@example.com", "alice", "        ", []string{"password"}},
+		{"alice@example.com", "alice", "short", []string{"password"}},
+		{"alice@example.com", "alice", strings.Repeat("ä", 40), []string{"password"}},
+		{"", "", "", []string{"email", "username", "password"}},
+	}
+	for _, tt := range tests {
+		err := ValidateUser(tt.email, tt.username, tt.password)
+		checkInvalidFields(t, "ValidateUser("+strconv.Quote(tt.email)+", "+strconv.Quote(tt.username)+")", err, tt.invalid)
+	}
+}
+
+func TestValidatePost(t *testing.T) {
+	tests := []struct {
+		title, content string
+		categoryIDs    []int
+		invalid        []string
+	}{
+		{"Title", "Content", []int{1}, nil},
+		{strings.Repeat("é", MaxTitleLength), "Content", []int{1}, nil},
+		{" \t", "Content", []int{1}, []string{"title"}},
+		{strings.Repeat("a", MaxTitleLength+1), "Content", []int{1}, []string{"title"}},
+		{"Title", "\n\n", []int{1}, []string{"content"}},
+		{"Title", strings.Repeat("a", MaxPostLength+1), []int{1}, []string{"content"}},
+		{"Title", "Content", nil, []string{"categories"}},
+	}
+	for _, tt := range tests {
+		err := ValidatePost(tt.title, tt.content, tt.categoryIDs)
+		checkInvalidFields(t, "ValidatePost("+strconv.Quote(tt.title)+")", err, tt.invalid)
+	}
+
+	checkInvalidFields(t, "ValidateComment", ValidateComment("   "), []string{"comment"})
+	checkInvalidFields(t, "ValidateComment", ValidateComment(strings.Repeat("a", MaxCommentLength+1)), []string{"comment"})
+	checkInvalidFields(t, "ValidateComment", ValidateComment("fine"), nil)
+}
+
+// The models refuse bad input themselves, whichever handler calls them.
+func TestCreateRejectsInvalidInput(t *testing.T) {
+	setupTestDB(t)
+	user := createTestUser(t, "author")
+	postID := createTestPost(t, user)
+
+	var invalid ValidationError
+	if _, err := CreatePost(user, "  ", "Content", []int{1}); !errors.As(err, &invalid) {
+		t.Errorf("CreatePost with a blank title: got %v, want a ValidationError", err)
+	}
+	if err := UpdatePost(postID, user, "Title", "Content", nil); !errors.As(err, &invalid) {
+		t.Errorf("UpdatePost without categories: got %v, want a ValidationError", err)
+	}
+	if _, err := CreateComment(user, strconv.Itoa(postID), " \n ", 0); !errors.As(err, &invalid) {
+		t.Errorf("CreateComment with a blank comment: got %v, want a ValidationError", err)
+	}
+	if n := count(t, "SELECT COUNT(*) FROM posts"); n != 1 {
+		t.Errorf("%d posts, want 1", n)
+	}
+}
+
+func checkInvalidFields(t *testing.T, call string, err error, want []string) {
+	t.Helper()
+	if len(want) == 0 {
+		if err != nil {
+			t.Errorf("%s: %v", call, err)
+		}
+		return
+	}
+	var invalid ValidationError
+	if !errors.As(err, &invalid) {
+		t.Errorf("%s: got %v, want a ValidationError", call, err)
+		return
+	}
+	if len(invalid) != len(want) {
+		t.Errorf("%s: refused fields %v, want %v", call, invalid, want)
+	}
+	for _, field := range want {
+		if invalid[field] == "" {
+			t.Errorf("%s: no message for %s in %v", call, field, invalid)
+		}
+	}
+}